@@ -0,0 +1,312 @@
+package nexus
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Definition holds the states, transitions, hooks and error handling of a machine, without
+// any runtime state. Build it once, then create as many instances from it as needed with
+// NewInstance; instances share the definition and only carry their own active states,
+// history, timers and ID.
+//
+// The first call to NewInstance freezes the definition: it is validated and every later
+// registration fails with ErrDefinitionFrozen, so that instances can read it without locking.
+type Definition[T any] struct {
+	FSMOptions
+	logger       fsmLogger
+	mu           sync.RWMutex
+	frozen       bool
+	states       *States
+	initial      State
+	transitions  []Transition[T]
+	byEvent      map[State]map[Event][]int // transitions by source state and event, in definition order
+	entryActions map[State][]Action[T]
+	exitActions  map[State][]Action[T]
+	errorState   State
+	errorHandler ActionFunc[T]
+	middleware   []Middleware[T]
+	rejected     []error // registrations refused by AddTransition and SetErrorHandler
+}
+
+// NewDefinition creates a machine definition starting in the given initial state. The options
+// that describe how instances run, such as WithClock or WithJournal, are the defaults of
+// every instance and can be overridden per instance.
+func NewDefinition[T any](initialState State, options ...FSMOptionFunc) *Definition[T] {
+	d := newDefinition[T](initialState, options)
+
+	if err := d.RegisterState(initialState); err != nil {
+		// This should never happen
+		panic("failed to register initial state: " + err.Error())
+	}
+	return d
+}
+
+// newDefinition allocates a definition with the given initial state without registering any
+// state.
+func newDefinition[T any](initialState State, options []FSMOptionFunc) *Definition[T] {
+	opts := DefaultOptions()
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return &Definition[T]{
+		FSMOptions:   opts,
+		logger:       newFSMLogger(baseLogger(opts), opts.LogLevel),
+		states:       NewStates(opts.maxStates),
+		initial:      initialState,
+		transitions:  make([]Transition[T], 0),
+		byEvent:      make(map[State]map[Event][]int),
+		entryActions: make(map[State][]Action[T]),
+		exitActions:  make(map[State][]Action[T]),
+	}
+}
+
+// Freeze validates the definition and, if it is sound, stops any further change to it.
+// Returns the problems reported by Validate otherwise, leaving the definition unfrozen.
+// Freezing a frozen definition does nothing.
+func (d *Definition[T]) Freeze() error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frozen = true
+	return nil
+}
+
+// NewInstance freezes the definition and creates an instance of it in the initial state.
+//
+// opts override the options that describe how the instance runs: WithMailboxSize,
+// WithMaxInternalEvents, WithClock and WithJournal; WithLogFields adds fields to the records
+// of the instance. Options that describe the definition, such as WithVersion, WithStrict or
+// the other logging options, are taken from the definition.
+//
+// Returns the problems reported by Validate if the definition is not frozen yet and fails
+// validation.
+func (d *Definition[T]) NewInstance(id string, opts ...FSMOptionFunc) (*FSM[T], error) {
+	d.mu.RLock()
+	frozen := d.frozen
+	d.mu.RUnlock()
+	if !frozen {
+		if err := d.Freeze(); err != nil {
+			return nil, err
+		}
+	}
+	return d.instance(id, opts), nil
+}
+
+// instance creates an FSM running the definition.
+func (d *Definition[T]) instance(id string, opts []FSMOptionFunc) *FSM[T] {
+	options := d.FSMOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	options.LogLevel, options.LogOutput, options.UseStdOut, options.Logger = d.LogLevel, d.LogOutput, d.UseStdOut, d.Logger
+	options.LogSampling = d.LogSampling
+	options.maxStates, options.Version, options.Strict = d.maxStates, d.Version, d.Strict
+
+	var entered map[State]time.Time
+	if options.Metrics != nil {
+		entered = make(map[State]time.Time)
+	}
+
+	var fields []slog.Attr
+	if id != "" {
+		fields = append(fields, slog.String("instance", id))
+	}
+	fields = append(fields, options.LogFields[len(d.LogFields):]...)
+
+	fsm := &FSM[T]{
+		Definition: d,
+		FSMOptions: options,
+		logger:     newFSMLogger(d.logger.With(fields...), d.LogLevel),
+		id:         id,
+		active:     d.states.defaultLeaves(d.initial),
+		history:    make(map[State][]State),
+		timers:     make(map[State]*stateTimer[T]),
+		entered:    entered,
+	}
+	initial := d.states.active(fsm.active)
+	fsm.updateTimers(nil, initial, nil)
+	fsm.trackStates(nil, initial)
+	return fsm
+}
+
+// mutable returns an error if the definition is frozen.
+// NOTE: Should be called with the lock
+func (d *Definition[T]) mutable(op string, state State) error {
+	if d.frozen {
+		return &StateError{Op: op, State: state, Err: ErrDefinitionFrozen}
+	}
+	return nil
+}
+
+// RegisterState adds a new state to the definition.
+//
+// Use WithParent to nest the state inside another one. Events that the current state does not
+// handle bubble up to its ancestors, so a transition registered on a parent applies to all of
+// its substates.
+func (d *Definition[T]) RegisterState(state State, opts ...StateOptionFunc) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.mutable("RegisterState", state); err != nil {
+		return err
+	}
+	if d.states == nil {
+		panic("FSM states slice is nil, this should not happen since it is initialized in New()")
+	}
+
+	err := d.states.Add(state, opts...)
+	if err != nil {
+		return err
+	}
+
+	d.logger.debug(context.Background(), "State registered", slog.String("state", string(state)), slog.String("parent", string(d.states.Parent(state))))
+	return nil
+}
+
+// OnEnter registers actions that run whenever the FSM enters the given state,
+// after the actions of the transition that leads into it.
+func (d *Definition[T]) OnEnter(state State, actions ...Action[T]) error {
+	return d.addHook("OnEnter", d.entryActions, state, actions)
+}
+
+// OnExit registers actions that run whenever the FSM leaves the given state,
+// before the actions of the transition that leads out of it.
+func (d *Definition[T]) OnExit(state State, actions ...Action[T]) error {
+	return d.addHook("OnExit", d.exitActions, state, actions)
+}
+
+// addHook appends actions to the hooks of a registered state.
+func (d *Definition[T]) addHook(op string, hooks map[State][]Action[T], state State, actions []Action[T]) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.mutable(op, state); err != nil {
+		return err
+	}
+	if !d.states.Exists(state) {
+		return &StateError{
+			Op:    op,
+			State: state,
+			Err:   ErrStateNotRegistered,
+		}
+	}
+	if d.Strict {
+		if problems := checkActions(actions, state, ""); len(problems) > 0 {
+			return problems[0]
+		}
+	}
+
+	hooks[state] = append(hooks[state], actions...)
+
+	d.logger.debug(context.Background(), "State hook registered", slog.String("state", string(state)), slog.String("hook", op), slog.Int("actions", len(actions)))
+	return nil
+}
+
+// AddTransition registers a new transition from one state to another on a given event.
+//
+// Several transitions may share the same from state and event as long as they are guarded;
+// they are evaluated in registration order and the first one whose guard passes is taken.
+//
+// The transition is left out if the definition is frozen, or in strict mode (see WithStrict)
+// when it refers to an unregistered state, has an action without a function or duplicates an
+// earlier transition. The reason is logged and reported by Validate.
+func (d *Definition[T]) AddTransition(from, to State, event Event, actions []Action[T], opts ...TransitionOptionFunc[T]) {
+	if err := d.addTransition(from, to, event, actions, opts...); err != nil {
+		d.reject(err)
+	}
+}
+
+// addTransition registers a transition, returning why it was left out if it was.
+func (d *Definition[T]) addTransition(from, to State, event Event, actions []Action[T], opts ...TransitionOptionFunc[T]) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.mutable("AddTransition", from); err != nil {
+		return err
+	}
+	if d.transitions == nil {
+		panic("FSM transitions slice is nil, this should not happen since it is initialized in New()")
+	}
+
+	transition := Transition[T]{
+		From:   from,
+		To:     to,
+		Event:  event,
+		Action: actions,
+	}
+	for _, opt := range opts {
+		opt(&transition)
+	}
+	if d.Strict {
+		if problems := d.checkTransition(&transition, d.candidates(from, event)); len(problems) > 0 {
+			return problems[0]
+		}
+	}
+	d.transitions = append(d.transitions, transition)
+	if d.byEvent[from] == nil {
+		d.byEvent[from] = make(map[Event][]int)
+	}
+	d.byEvent[from][event] = append(d.byEvent[from][event], len(d.transitions)-1)
+
+	if ctx := context.Background(); d.logger.enabled(ctx, slog.LevelDebug) {
+		actionNames := make([]string, len(actions))
+		for i, a := range actions {
+			actionNames[i] = a.Name
+		}
+		d.logger.debug(ctx, "Transition registered",
+			slog.String("from", string(from)),
+			slog.String("to", string(to)),
+			slog.String("event", string(event)),
+			slog.Any("actions", actionNames),
+			slog.String("guard", transition.Guard.Name))
+	}
+	return nil
+}
+
+// SetErrorHandler configures an error handler and error state.
+// When a transition error occurs, the error handler will be called
+// and the FSM will transition to the error state.
+//
+// Nothing changes if the definition is frozen; this is logged and reported by Validate.
+func (d *Definition[T]) SetErrorHandler(errorState State, handler ActionFunc[T]) {
+	if err := d.setErrorHandler(errorState, handler); err != nil {
+		d.reject(err)
+	}
+}
+
+// setErrorHandler sets the error handler and error state, returning an error if the
+// definition is frozen.
+func (d *Definition[T]) setErrorHandler(errorState State, handler ActionFunc[T]) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.mutable("SetErrorHandler", errorState); err != nil {
+		return err
+	}
+	d.errorState = errorState
+	d.errorHandler = handler
+	return nil
+}
+
+// reject records a registration that was refused, for Validate to report.
+func (d *Definition[T]) reject(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rejected = append(d.rejected, err)
+	d.logger.error(context.Background(), "Registration rejected", errAttr(err))
+}
+
+// candidates returns the positions in d.transitions of the transitions registered for a state
+// and event, in definition order.
+// NOTE: Should be called with the lock
+func (d *Definition[T]) candidates(state State, event Event) []int {
+	return d.byEvent[state][event]
+}
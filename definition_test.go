@@ -0,0 +1,152 @@
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOrderDefinition(t testing.TB, opts ...FSMOptionFunc) *Definition[TestData] {
+	t.Helper()
+	def := NewDefinition[TestData](State("cart"), opts...)
+	assert.NoError(t, def.RegisterState(State("awaiting_payment"), WithTimeout(time.Hour, Event("expire"))))
+	assert.NoError(t, def.RegisterState(State("paid"), Final()))
+	assert.NoError(t, def.RegisterState(State("expired"), Final()))
+	def.AddTransition(State("cart"), State("awaiting_payment"), Event("checkout"), []Action[TestData]{{
+		Name: "count",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			args.Counter++
+			return args, nil
+		},
+	}})
+	def.AddTransition(State("awaiting_payment"), State("paid"), Event("pay"), nil)
+	def.AddTransition(State("awaiting_payment"), State("expired"), Event("expire"), nil)
+	return def
+}
+
+func TestDefinition_InstancesShareDefinition(t *testing.T) {
+	def := newOrderDefinition(t)
+
+	first, err := def.NewInstance("order-1")
+	assert.NoError(t, err)
+	second, err := def.NewInstance("order-2")
+	assert.NoError(t, err)
+	assert.Same(t, first.Definition, second.Definition)
+	assert.Equal(t, "order-1", first.ID())
+
+	_, err = first.Trigger(context.Background(), Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+	_, err = first.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, State("paid"), first.GetState())
+	assert.Equal(t, State("cart"), second.GetState())
+}
+
+func TestDefinition_FrozenAfterFirstInstance(t *testing.T) {
+	def := newOrderDefinition(t)
+	fsm, err := def.NewInstance("order-1")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, def.RegisterState(State("refunded")), ErrDefinitionFrozen)
+	assert.ErrorIs(t, fsm.OnEnter(State("paid")), ErrDefinitionFrozen)
+	assert.NoError(t, def.Validate())
+
+	def.AddTransition(State("paid"), State("cart"), Event("reopen"), nil)
+	fsm.SetErrorHandler(State("expired"), nil)
+	assert.Len(t, def.transitions, 3)
+	assert.Empty(t, def.errorState)
+	assert.ErrorIs(t, def.Validate(), ErrDefinitionFrozen)
+}
+
+func TestDefinition_FreezeValidates(t *testing.T) {
+	def := NewDefinition[TestData](State("cart"))
+	assert.NoError(t, def.RegisterState(State("paid")))
+	def.AddTransition(State("cart"), State("paid"), Event("pay"), nil)
+
+	_, err := def.NewInstance("order-1")
+	assert.ErrorIs(t, err, ErrDeadEndState)
+
+	assert.NoError(t, def.RegisterState(State("done"), Final()))
+	def.AddTransition(State("paid"), State("done"), Event("ship"), nil)
+	_, err = def.NewInstance("order-1")
+	assert.NoError(t, err)
+}
+
+func TestDefinition_InstanceOptions(t *testing.T) {
+	var logs bytes.Buffer
+	def := newOrderDefinition(t, WithVersion("v1"), WithLogOutput(&logs), WithLogLevel(slog.LevelDebug))
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	journal := NewMemoryJournal()
+	fsm, err := def.NewInstance("order-1", WithClock(clock), WithJournal(journal), WithVersion("v2"))
+	assert.NoError(t, err)
+	other, err := def.NewInstance("order-2")
+	assert.NoError(t, err)
+
+	_, err = fsm.Trigger(context.Background(), Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+	_, err = other.Trigger(context.Background(), Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, State("expired"), fsm.GetState())
+	assert.Equal(t, State("awaiting_payment"), other.GetState())
+	entries, err := journal.Entries(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "v1", fsm.Snapshot().Version)
+	assert.Contains(t, logs.String(), `"instance":"order-1"`)
+}
+
+func TestDefinition_InstanceArmsInitialTimeouts(t *testing.T) {
+	def := NewDefinition[TestData](State("root"))
+	assert.NoError(t, def.RegisterState(State("wait"), WithParent(State("root")), WithTimeout(time.Second, Event("to"))))
+	assert.NoError(t, def.RegisterState(State("done"), Final()))
+	def.AddTransition(State("wait"), State("done"), Event("to"), nil)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm, err := def.NewInstance("order-1", WithClock(clock))
+	assert.NoError(t, err)
+	assert.Equal(t, State("wait"), fsm.GetState())
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, State("done"), fsm.GetState())
+}
+
+func TestDefinition_ConcurrentInstances(t *testing.T) {
+	def := newOrderDefinition(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		fsm, err := def.NewInstance(fmt.Sprintf("order-%d", i))
+		assert.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := &TestData{}
+			_, err := fsm.Trigger(context.Background(), Event("checkout"), data)
+			assert.NoError(t, err)
+			_, err = fsm.Trigger(context.Background(), Event("pay"), data)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, data.Counter)
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkDefinition_NewInstance(b *testing.B) {
+	def := newOrderDefinition(b, WithLogLevel(LevelOff))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := def.NewInstance(""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package nexus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the machine definition as a Graphviz DOT digraph.
+//
+// States with substates are drawn as clusters, parallel ones with a dashed border. Edges are
+// labelled "event [guard] / action, action". The initial state is pointed at by a start dot,
+// the current configuration is filled in, the error state is drawn in red and final states
+// have a double border. States and edges are written in registration order, so the output
+// only changes when the machine does.
+func (f *FSM[T]) WriteDOT(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	d := &lineWriter{w: bw, active: make(map[State]bool)}
+	for _, state := range f.states.active(f.active) {
+		d.active[state] = true
+	}
+
+	d.line(0, "digraph fsm {")
+	d.line(1, "compound=true;")
+	d.line(1, "rankdir=LR;")
+	d.line(1, `node [shape=box, style="rounded"];`)
+	d.line(1, `__start [shape=point, width=0.2];`)
+
+	for _, state := range f.states.Keys() {
+		if f.states.Parent(state) == "" {
+			f.writeDOTState(d, state, 1)
+		}
+	}
+
+	d.line(1, "__start -> %s;", dotQuote(string(f.initial)))
+	for _, t := range f.transitions {
+		attrs := []string{"label=" + dotQuote(transitionLabel(&t))}
+		if len(f.states.Children(t.From)) > 0 {
+			attrs = append(attrs, "ltail="+dotQuote("cluster_"+string(t.From)))
+		}
+		if len(f.states.Children(t.To)) > 0 {
+			attrs = append(attrs, "lhead="+dotQuote("cluster_"+string(t.To)))
+		}
+		d.line(1, "%s -> %s [%s];", dotQuote(string(t.From)), dotQuote(string(t.To)), strings.Join(attrs, ", "))
+	}
+	d.line(0, "}")
+
+	if d.err != nil {
+		return d.err
+	}
+	return bw.Flush()
+}
+
+// writeDOTState writes a state, and its substates if it has any.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) writeDOTState(d *lineWriter, state State, depth int) {
+	children := f.states.Children(state)
+	histories := f.states.Histories(state)
+	if len(children) == 0 && len(histories) == 0 {
+		if attrs := f.dotAttrs(d, state); len(attrs) > 0 {
+			d.line(depth, "%s [%s];", dotQuote(string(state)), strings.Join(attrs, ", "))
+		} else {
+			d.line(depth, "%s;", dotQuote(string(state)))
+		}
+		return
+	}
+
+	d.line(depth, "subgraph %s {", dotQuote("cluster_"+string(state)))
+	d.line(depth+1, "label=%s;", dotQuote(string(state)))
+	if f.states.IsParallel(state) {
+		d.line(depth+1, `style="dashed";`)
+	}
+	if d.active[state] {
+		d.line(depth+1, `bgcolor="lightblue";`)
+	}
+	if state == f.errorState {
+		d.line(depth+1, `color="red";`)
+	}
+	d.line(depth+1, "%s [shape=point, style=invis];", dotQuote(string(state)))
+	for _, child := range children {
+		f.writeDOTState(d, child, depth+1)
+	}
+	for _, history := range histories {
+		label := "H"
+		if f.states.HistoryKind(history) == HistoryDeep {
+			label = "H*"
+		}
+		d.line(depth+1, "%s [shape=circle, label=%s];", dotQuote(string(history)), dotQuote(label))
+	}
+	d.line(depth, "}")
+}
+
+// dotAttrs returns the attributes of a leaf state node.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) dotAttrs(d *lineWriter, state State) []string {
+	var attrs []string
+	if d.active[state] {
+		attrs = append(attrs, `style="rounded,filled"`, `fillcolor="lightblue"`)
+	}
+	if state == f.errorState {
+		attrs = append(attrs, `color="red"`, `fontcolor="red"`)
+	}
+	if f.states.IsFinal(state) {
+		attrs = append(attrs, "peripheries=2")
+	}
+	return attrs
+}
+
+// transitionLabel describes a transition as "event [guard] / action, action".
+func transitionLabel[T any](t *Transition[T]) string {
+	var b strings.Builder
+	b.WriteString(string(t.Event))
+	if t.Guard.Name != "" {
+		fmt.Fprintf(&b, " [%s]", t.Guard.Name)
+	}
+	if len(t.Action) > 0 {
+		names := make([]string, len(t.Action))
+		for i, a := range t.Action {
+			names[i] = a.Name
+		}
+		fmt.Fprintf(&b, " / %s", strings.Join(names, ", "))
+	}
+	return b.String()
+}
+
+// lineWriter writes indented lines and remembers the first write error.
+type lineWriter struct {
+	w      *bufio.Writer
+	active map[State]bool
+	err    error
+}
+
+func (d *lineWriter) line(depth int, format string, args ...any) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, "%s%s\n", strings.Repeat("  ", depth), fmt.Sprintf(format, args...))
+}
+
+// dotQuote quotes a string as a DOT ID.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,60 @@
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_WriteDOT(t *testing.T) {
+	fsm := New[TestData](State("cart"))
+	fsm.RegisterState(State("fulfilment"))
+	fsm.RegisterState(State("picking"), WithParent(State("fulfilment")))
+	fsm.RegisterState(State("packing"), WithParent(State("fulfilment")))
+	fsm.RegisterState(State("failed"))
+	fsm.SetErrorHandler(State("failed"), nil)
+
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+	fsm.AddTransition(State("cart"), State("fulfilment"), Event("pay"),
+		[]Action[TestData]{{Name: "charge", Fn: noop}, {Name: "email", Fn: noop}},
+		WithGuard("in_stock", func(ctx context.Context, args *TestData) bool { return true }))
+	fsm.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	fsm.AddTransition(State("fulfilment"), State("cart"), Event("cancel"), nil)
+
+	fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+
+	var buf bytes.Buffer
+	assert.NoError(t, fsm.WriteDOT(&buf))
+
+	expected := `digraph fsm {
+  compound=true;
+  rankdir=LR;
+  node [shape=box, style="rounded"];
+  __start [shape=point, width=0.2];
+  "cart";
+  subgraph "cluster_fulfilment" {
+    label="fulfilment";
+    bgcolor="lightblue";
+    "fulfilment" [shape=point, style=invis];
+    "picking" [style="rounded,filled", fillcolor="lightblue"];
+    "packing";
+  }
+  "failed" [color="red", fontcolor="red"];
+  __start -> "cart";
+  "cart" -> "fulfilment" [label="pay [in_stock] / charge, email", lhead="cluster_fulfilment"];
+  "picking" -> "packing" [label="picked"];
+  "fulfilment" -> "cart" [label="cancel", ltail="cluster_fulfilment"];
+}
+`
+	assert.Equal(t, expected, buf.String())
+
+	var again bytes.Buffer
+	assert.NoError(t, fsm.WriteDOT(&again))
+	assert.Equal(t, buf.String(), again.String())
+}
+
+func TestDotQuote(t *testing.T) {
+	assert.Equal(t, `"say \"hi\" \\ bye"`, dotQuote(`say "hi" \ bye`))
+}
@@ -7,12 +7,19 @@ import (
 
 // FSM operation errors
 var (
-	ErrInvalidState       = errors.New("invalid state")
-	ErrInvalidEvent       = errors.New("invalid event")
-	ErrNoTransition       = errors.New("no transition registered for state and event")
-	ErrStateNotRegistered = errors.New("state not registered")
-	ErrStateAlreadyExists = errors.New("state already exists")
-	ErrStateSizeExceeded  = errors.New("maximum number of states exceeded")
+	ErrInvalidState         = errors.New("invalid state")
+	ErrInvalidEvent         = errors.New("invalid event")
+	ErrNotInTransition      = errors.New("not called from within a transition")
+	ErrInternalEventLimit   = errors.New("internal event limit reached")
+	ErrNoTransition         = errors.New("no transition registered for state and event")
+	ErrStateNotRegistered   = errors.New("state not registered")
+	ErrStateAlreadyExists   = errors.New("state already exists")
+	ErrStateSizeExceeded    = errors.New("maximum number of states exceeded")
+	ErrInvalidHistory       = errors.New("history state must be nested in a regular state")
+	ErrUnsupportedConstruct = errors.New("construct not supported by nexus")
+	ErrUnreachableState     = errors.New("state is unreachable from the initial state")
+	ErrDeadEndState         = errors.New("state has no outgoing transitions and is not final")
+	ErrDefinitionFrozen     = errors.New("definition is frozen")
 )
 
 // Action errors
@@ -20,6 +27,12 @@ var (
 	ErrActionNil       = errors.New("action function is nil")
 	ErrActionFailed    = errors.New("action execution failed")
 	ErrNoActionDefined = errors.New("no action function defined")
+	ErrUnknownAction   = errors.New("action not registered")
+	ErrUnknownGuard    = errors.New("guard not registered")
+	ErrActionPanicked  = errors.New("action panicked")
+
+	ErrActionAlreadyExists = errors.New("action already registered")
+	ErrGuardAlreadyExists  = errors.New("guard already registered")
 )
 
 // State transition errors
@@ -27,6 +40,31 @@ var (
 	ErrTransitionFailed        = errors.New("state transition failed")
 	ErrInvalidTransition       = errors.New("invalid state transition")
 	ErrTransitionAlreadyExists = errors.New("transition already exists")
+	ErrGuardRejected           = errors.New("transition rejected by guard")
+)
+
+// Snapshot errors
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+	ErrVersionMismatch = errors.New("snapshot version does not match FSM version")
+)
+
+// Journal errors
+var (
+	ErrReplayedFailure = errors.New("replayed action failure")
+)
+
+// Store errors
+var (
+	ErrRecordNotFound  = errors.New("record not found")
+	ErrVersionConflict = errors.New("record version conflict")
+)
+
+// Manager errors
+var (
+	ErrInstanceExists   = errors.New("instance already exists")
+	ErrInstanceNotFound = errors.New("instance not found")
+	ErrStoreRequired    = errors.New("operation requires a store")
 )
 
 // FSM lifecycle errors
@@ -34,6 +72,7 @@ var (
 	ErrFSMNotInitialized = errors.New("FSM not initialized")
 	ErrFSMAlreadyRunning = errors.New("FSM already running")
 	ErrFSMStopped        = errors.New("FSM has been stopped")
+	ErrMailboxFull       = errors.New("FSM mailbox is full")
 )
 
 type StateError struct {
@@ -96,3 +135,31 @@ func (e *EventError) Error() string {
 func (e *EventError) Unwrap() error {
 	return e.Err
 }
+
+type InstanceError struct {
+	Op  string
+	ID  string
+	Err error
+}
+
+func (e *InstanceError) Error() string {
+	return fmt.Sprintf("instance error during %s of '%s': %v", e.Op, e.ID, e.Err)
+}
+
+func (e *InstanceError) Unwrap() error {
+	return e.Err
+}
+
+type StoreError struct {
+	Op  string
+	ID  string
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("store error during %s of '%s': %v", e.Op, e.ID, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
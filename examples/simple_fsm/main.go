@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"log/slog"
 	"os"
 
 	"github.com/IbrahimShahzad/nexus"
@@ -22,7 +23,7 @@ func main() {
 	machine := nexus.New[MyData]("idle",
 		nexus.WithLogOutput(os.Stdout),
 		nexus.WithLogConsole(), // otherwise logs are in JSON format
-		nexus.WithLogLevel(zerolog.DebugLevel))
+		nexus.WithLogLevel(slog.LevelDebug))
 
 	// Register states
 	if err := machine.RegisterState("processing"); err != nil {
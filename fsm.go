@@ -3,70 +3,15 @@ package nexus
 import (
 	"context"
 	"io"
-	"os"
+	"log/slog"
+	"slices"
 	"sync"
-
-	"github.com/rs/zerolog"
+	"time"
 )
 
 // State represents a state in the finite state machine.
 type State string
 
-// States manages a collection of unique states.
-type States struct {
-	stateMap map[State]struct{}
-	maxSize  int
-}
-
-// NewStates creates a new States collection with maximum size.
-func NewStates(size int) *States {
-	return &States{
-		stateMap: make(map[State]struct{}),
-		maxSize:  size,
-	}
-}
-
-// limitReached checks if the maximum number of states has been reached.
-func (s *States) limitReached() bool {
-	return s.maxSize > 0 && len(s.stateMap) >= s.maxSize
-}
-
-// Add adds a new state to the collection.
-func (s *States) Add(state State) error {
-	if s.Exists(state) {
-		return &StateError{
-			Op:    "Add",
-			State: state,
-			Err:   ErrStateAlreadyExists,
-		}
-	}
-
-	if s.limitReached() {
-		return &StateError{
-			Op:    "Add",
-			State: state,
-			Err:   ErrStateSizeExceeded,
-		}
-	}
-	s.stateMap[state] = struct{}{}
-	return nil
-}
-
-// Exists checks if a state exists in the collection.
-func (s *States) Exists(state State) bool {
-	_, exists := s.stateMap[state]
-	return exists
-}
-
-// Keys returns a slice of all registered states.
-func (s *States) Keys() []State {
-	keys := make([]State, 0, len(s.stateMap))
-	for k := range s.stateMap {
-		keys = append(keys, k)
-	}
-	return keys
-}
-
 // Event represents an event that triggers a state transition.
 type Event string
 
@@ -74,53 +19,114 @@ type Event string
 type Action[T any] struct {
 	Name string
 	Fn   ActionFunc[T]
+	// Middleware wraps this action only, inside machine and transition middleware.
+	Middleware []Middleware[T]
 }
 
 // ActionFunc is a function that performs an action during a state transition.
 type ActionFunc[T any] func(ctx context.Context, args *T) (*T, error)
 
+// GuardFunc is a predicate that decides whether a transition may be taken.
+type GuardFunc[T any] func(ctx context.Context, args *T) bool
+
+// Guard is a named condition checked before a transition is taken.
+// A guard with a nil Fn always passes.
+type Guard[T any] struct {
+	Name string
+	Fn   GuardFunc[T]
+}
+
 // Transition triggered by an event.
 type Transition[T any] struct {
 	From   State
 	To     State
 	Event  Event
 	Action []Action[T]
+	Guard  Guard[T]
+	// Middleware wraps every action of the transition.
+	Middleware []Middleware[T]
+}
+
+// TransitionOptionFunc configures a transition when it is registered.
+type TransitionOptionFunc[T any] func(*Transition[T])
+
+// WithGuard attaches a guard to a transition. The transition is only taken
+// when the guard returns true.
+func WithGuard[T any](name string, fn GuardFunc[T]) TransitionOptionFunc[T] {
+	return func(t *Transition[T]) {
+		t.Guard = Guard[T]{Name: name, Fn: fn}
+	}
+}
+
+// allows reports whether the transition's guard passes.
+func (t *Transition[T]) allows(ctx context.Context, args *T) bool {
+	return t.Guard.Fn == nil || t.Guard.Fn(ctx, args)
 }
 
 // FSMOptions holds configuration options for the FSM.
 type FSMOptions struct {
-	LogLevel  zerolog.Level
+	LogLevel  slog.Level
 	LogOutput io.Writer
+	// Logger receives the records of the FSM. When nil, they are written to LogOutput, or
+	// dropped if there is no output either.
+	Logger Logger
+	// LogFields are added to every record of the FSM.
+	LogFields []slog.Attr
 	maxStates int
 	UseStdOut bool
+	// LogSampling thins out repeated records.
+	LogSampling LogSampling
+	// MailboxSize is the number of events Send can queue while the FSM is running.
+	MailboxSize int
+	// MaxInternalEvents caps how many events raised by actions a single Trigger processes.
+	MaxInternalEvents int
+	// Clock is the time source used for state timeouts.
+	Clock Clock
+	// Version identifies the machine definition in snapshots.
+	Version string
+	// Journal records every event the FSM processes.
+	Journal Journal
+	// Strict makes registration reject definitions that Validate would report.
+	Strict bool
+	// WatchBuffer is the number of notifications a Watch channel holds before dropping new ones.
+	WatchBuffer int
+	// Metrics receives transition counts, action latencies and time spent in states.
+	Metrics MetricsExporter
+	// Tracer traces triggered events and the actions they run.
+	Tracer Tracer
 }
 
 // DefaultOptions returns the default FSM configuration.
 func DefaultOptions() FSMOptions {
 	return FSMOptions{
-		LogLevel:  zerolog.InfoLevel,
-		LogOutput: os.Stdout,
-		maxStates: 0, // 0 means no limit
+		LogLevel:          slog.LevelInfo,
+		maxStates:         0, // 0 means no limit
+		MailboxSize:       64,
+		MaxInternalEvents: 100,
+		Clock:             SystemClock(),
+		WatchBuffer:       16,
 	}
 }
 
 type FSMOptionFunc func(*FSMOptions)
 
 // WithLogLevel sets the log level for the FSM.
-func WithLogLevel(level zerolog.Level) FSMOptionFunc {
+func WithLogLevel(level slog.Level) FSMOptionFunc {
 	return func(opts *FSMOptions) {
 		opts.LogLevel = level
 	}
 }
 
-// WithLogOutput sets the writer where logs will be written.
+// WithLogOutput sets the writer where logs will be written when no Logger is set. Without
+// it, or WithLogConsole, the FSM logs nothing.
 func WithLogOutput(w io.Writer) FSMOptionFunc {
 	return func(opts *FSMOptions) {
 		opts.LogOutput = w
 	}
 }
 
-// WithLogConsole switches the FSM logger to human-friendly console output.
+// WithLogConsole switches the FSM logger to human-friendly console output, written to stdout
+// unless WithLogOutput says otherwise.
 func WithLogConsole() FSMOptionFunc {
 	return func(opts *FSMOptions) {
 		opts.UseStdOut = true
@@ -134,152 +140,336 @@ func WithMaxStates(max int) FSMOptionFunc {
 	}
 }
 
-// FSM is the Finite State Machine
-type FSM[T any] struct {
-	FSMOptions
-	logger       zerolog.Logger
-	states       *States
-	mu           sync.RWMutex
-	currentState State
-	transitions  []Transition[T]
-	errorState   State
-	errorHandler ActionFunc[T]
+// WithMailboxSize sets how many events Send can queue while the FSM is running.
+func WithMailboxSize(size int) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.MailboxSize = size
+	}
 }
 
-// SetLogLevel updates the log level at runtime.
-func (f *FSM[T]) SetLogLevel(level zerolog.Level) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	f.LogLevel = level
-	f.logger = f.logger.Level(level)
+// WithMaxInternalEvents sets how many events raised by actions a single Trigger processes
+// before giving up with ErrInternalEventLimit. 0 means no limit.
+func WithMaxInternalEvents(max int) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.MaxInternalEvents = max
+	}
 }
 
-// setLogger initializes the logger based on options.
-func setLogger(useStdOut bool, logOutput io.Writer, level zerolog.Level) zerolog.Logger {
-	var baseLogger zerolog.Logger
-	if useStdOut {
-		cw := zerolog.ConsoleWriter{Out: logOutput}
-		baseLogger = zerolog.New(cw).With().Timestamp().Str("component", "fsm").Logger()
-		return baseLogger.Level(level)
+// WithClock sets the time source used for state timeouts. Tests can pass a FakeClock to
+// fire timeouts without sleeping.
+func WithClock(clock Clock) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Clock = clock
 	}
+}
 
-	baseLogger = zerolog.New(logOutput).With().Timestamp().Str("component", "fsm").Logger()
-	return baseLogger.Level(level)
+// WithVersion sets the definition version recorded in snapshots. Restore rejects snapshots
+// taken with a different version.
+func WithVersion(version string) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Version = version
+	}
 }
 
-// New creates a new FSM instance
-func New[T any](initialState State, options ...FSMOptionFunc) *FSM[T] {
-	opts := DefaultOptions()
-	for _, opt := range options {
-		opt(&opts)
+// WithJournal records every event the FSM processes in j.
+func WithJournal(j Journal) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Journal = j
 	}
+}
 
-	fsm := &FSM[T]{
-		currentState: initialState,
-		FSMOptions:   opts,
-		logger:       setLogger(opts.UseStdOut, opts.LogOutput, opts.LogLevel),
-		states:       NewStates(opts.maxStates),
-		transitions:  make([]Transition[T], 0),
+// WithWatchBuffer sets how many notifications a Watch channel holds before new ones are
+// dropped.
+func WithWatchBuffer(size int) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.WatchBuffer = size
 	}
+}
+
+// FSM is the Finite State Machine. An FSM created with New owns its definition and can keep
+// registering states and transitions; one created with Definition.NewInstance shares a frozen
+// definition with other instances.
+type FSM[T any] struct {
+	*Definition[T]
+	FSMOptions
+	logger  fsmLogger
+	mu      sync.RWMutex
+	id      string
+	active  []State
+	history map[State][]State
+	timers  map[State]*stateTimer[T]
+	entered map[State]time.Time // when each active state was entered, kept for metrics
+	started bool                // set once an event was dispatched or the state was set or restored
+	runLoop[T]
+	binding
+	observers
+	recording *JournalEntry
+	replay    *replayState[T]
+}
+
+// SetLogLevel updates the log level at runtime. For an FSM created with New it applies to
+// the records of its definition, such as registrations, as well.
+func (f *FSM[T]) SetLogLevel(level slog.Level) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.LogLevel = level
+	f.logger.level.Set(level)
+}
+
+// New creates a new FSM instance with its own definition.
+func New[T any](initialState State, options ...FSMOptionFunc) *FSM[T] {
+	fsm := newFSM[T](initialState, options)
 
 	if err := fsm.RegisterState(initialState); err != nil {
 		// This should never happen
 		panic("failed to register initial state: " + err.Error())
 	}
 
-	fsm.logger.Info().
-		Str("initialState", string(initialState)).
-		Msg("FSM initialized")
+	fsm.logger.info(context.Background(), "FSM initialized",
+		slog.String("initialState", string(initialState)))
+
+	return fsm
+}
 
+// newFSM allocates an FSM with its own definition in the given initial state without
+// registering any state.
+func newFSM[T any](initialState State, options []FSMOptionFunc) *FSM[T] {
+	fsm := newDefinition[T](initialState, options).instance("", nil)
+	// The definition is the FSM's own, so that SetLogLevel applies to its records too.
+	fsm.logger.level = fsm.Definition.logger.level
 	return fsm
 }
 
-// RegisterState adds a new state to the FSM.
-func (f *FSM[T]) RegisterState(state State) error {
+// ID returns the ID the instance was created with, or an empty string for an FSM created
+// with New.
+func (f *FSM[T]) ID() string {
+	return f.id
+}
+
+// RegisterState adds a new state to the definition of the FSM.
+// See Definition.RegisterState.
+//
+// Until the FSM processes its first event, or its state is set or restored, registering a
+// substate of the initial state moves it into the initial substates, as if it had started there.
+func (f *FSM[T]) RegisterState(state State, opts ...StateOptionFunc) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if f.states == nil {
-		panic("FSM states slice is nil, this should not happen since it is initialized in New()")
-	}
-
-	err := f.states.Add(state)
-	if err != nil {
+	if err := f.Definition.RegisterState(state, opts...); err != nil {
 		return err
 	}
-
-	f.logger.Debug().Str("state", string(state)).Msg("State registered")
+	if !f.started {
+		f.resolveInitial()
+	}
 	return nil
 }
 
-// AddTransition registers a new transition in the FSM from one state to another on a given event.
-func (f *FSM[T]) AddTransition(from, to State, event Event, actions []Action[T]) {
+// resetInitial makes the initial configuration active, for the parsers once every state of
+// the machine they build is registered.
+func (f *FSM[T]) resetInitial() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	f.resolveInitial()
+}
 
-	if f.transitions == nil {
-		panic("FSM transitions slice is nil, this should not happen since it is initialized in New()")
-	}
+// resolveInitial makes the initial configuration of the definition active, for when the
+// states it is made of change before the FSM leaves it.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) resolveInitial() {
+	f.active = f.states.defaultLeaves(f.initial)
+	f.resetTimers(nil)
+	f.restartStateTimes()
+}
 
-	f.transitions = append(f.transitions, Transition[T]{
-		From:   from,
-		To:     to,
-		Event:  event,
-		Action: actions,
-	})
+// OnEnter registers actions that run whenever the FSM enters the given state,
+// after the actions of the transition that leads into it.
+func (f *FSM[T]) OnEnter(state State, actions ...Action[T]) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Definition.OnEnter(state, actions...)
+}
 
-	actionNames := make([]string, len(actions))
-	for i, a := range actions {
-		actionNames[i] = a.Name
-	}
-	f.logger.Debug().
-		Str("from", string(from)).
-		Str("to", string(to)).
-		Str("event", string(event)).
-		Interface("actions", actionNames).
-		Msg("Transition registered")
+// OnExit registers actions that run whenever the FSM leaves the given state,
+// before the actions of the transition that leads out of it.
+func (f *FSM[T]) OnExit(state State, actions ...Action[T]) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Definition.OnExit(state, actions...)
+}
+
+// AddTransition registers a new transition in the FSM from one state to another on a given
+// event. See Definition.AddTransition.
+func (f *FSM[T]) AddTransition(from, to State, event Event, actions []Action[T], opts ...TransitionOptionFunc[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Definition.AddTransition(from, to, event, actions, opts...)
+}
+
+// addTransition registers a transition like AddTransition, returning the error instead of
+// leaving it for Validate to report.
+func (f *FSM[T]) addTransition(from, to State, event Event, actions []Action[T], opts ...TransitionOptionFunc[T]) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Definition.addTransition(from, to, event, actions, opts...)
 }
 
 // Trigger attempts to transition the FSM to a new state based on the given event.
 //
+// Actions run in a fixed order: the exit hooks of the current state, then the actions of the
+// transition, then the entry hooks of the new state. A failure in any of them aborts the
+// transition and follows the same error path.
+//
+// With nested states the event is first offered to the current state and then to each of its
+// ancestors. Every state left by the transition is exited innermost first, up to the innermost
+// state containing both ends of the transition, and every state entered is entered outermost
+// first. A target with substates is entered down through its initial substates, and a target
+// that is a history pseudo-state re-enters the substates its parent remembered.
+//
+// When parallel regions are active the event is offered to every active leaf, in document
+// order, and all the transitions found are taken in one step. If two of them would leave the
+// same state, the one defined on the more deeply nested source wins, and otherwise the one
+// found first. The step then runs all exit hooks (innermost and last region first), the
+// actions of every selected transition in document order, and all entry hooks (outermost and
+// first region first). The first failure aborts the whole step: the remaining actions are
+// skipped and the active configuration is not updated before the error path is taken.
+//
 // Returns an error if no transition is registered for the current state or event, or if the action fails.
 // If an error occurs and an error handler is configured, it will be called and the FSM will
 // transition to the error state before returning the error.
+//
+// If transitions exist for the current state and event but none of their guards pass, a
+// TransitionError wrapping ErrGuardRejected is returned and the state is left unchanged;
+// the error handler is not called in that case.
+//
+// Actions may call Raise with the context they receive to queue follow-up events. Those are
+// processed in order once the current transition has completed and before Trigger returns,
+// each receiving the args returned by the previous step.
 func (f *FSM[T]) Trigger(ctx context.Context, event Event, args *T) (*T, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	f.logger.Debug().Str("currentState", string(f.currentState)).Str("event", string(event)).Msg("Trigger called")
+	return f.dispatch(ctx, event, args)
+}
+
+// dispatch processes an event and every internal event raised while processing it, then saves
+// the new state if the FSM is bound to a store.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) dispatch(ctx context.Context, event Event, args *T) (_ *T, err error) {
+	ctx, end := f.traceTrigger(ctx, event)
+	defer func() { end(err) }()
+
+	f.started = true
+	if f.store == nil {
+		return f.dispatchEvents(ctx, event, args)
+	}
+
+	before := f.snapshot()
+	f.unsaved = &unsaved{}
+	args, err = f.dispatchEvents(ctx, event, args)
+	held := f.unsaved
+	f.unsaved = nil
+
+	if err == nil || !slices.Equal(before.Active, f.active) {
+		if perr := f.persist(ctx); perr != nil {
+			f.restore(before)
+			f.publish(ctx, held, perr)
+			return args, perr
+		}
+	}
+	f.publish(ctx, held, nil)
+	return args, err
+}
+
+// dispatchEvents processes an event followed by the internal events raised while processing it.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) dispatchEvents(ctx context.Context, event Event, args *T) (*T, error) {
+	queue := &eventQueue{}
+	ctx = context.WithValue(ctx, eventQueueKey{}, queue)
+
+	args, err := f.step(ctx, event, args)
+	for processed := 0; err == nil && len(queue.events) > 0; processed++ {
+		if f.MaxInternalEvents > 0 && processed >= f.MaxInternalEvents {
+			f.logger.error(ctx, "Internal event limit reached",
+				slog.String("state", string(f.current())),
+				slog.String("event", string(event)),
+				slog.Int("limit", f.MaxInternalEvents))
+
+			return args, &EventError{
+				Event: string(queue.events[0]),
+				State: string(f.current()),
+				Err:   ErrInternalEventLimit,
+			}
+		}
+
+		next := queue.pop()
+		f.logger.debug(ctx, "Processing internal event", slog.String("event", string(next)))
+		args, err = f.step(ctx, next, args)
+	}
+	return args, err
+}
+
+// step processes a single event and records it in the journal, if one is configured.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) step(ctx context.Context, event Event, args *T) (*T, error) {
+	if f.replay != nil || (f.Journal == nil && f.Metrics == nil) {
+		return f.microstep(ctx, event, args)
+	}
+
+	from := f.current()
+	var entry *JournalEntry
+	if f.Journal != nil {
+		entry = f.beginEntry(event, args)
+	}
+	args, err := f.microstep(ctx, event, args)
+
+	if f.Metrics != nil {
+		f.countTransition(from, f.current(), event, outcomeOf(err))
+	}
+	if entry != nil {
+		f.endEntry(entry, err)
+		f.appendEntry(ctx, *entry)
+	}
+	return args, err
+}
+
+// microstep processes a single event: it selects the transitions, runs the hooks and actions
+// and commits the new configuration.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) microstep(ctx context.Context, event Event, args *T) (*T, error) {
+	current := f.current()
+	f.logger.debug(ctx, "Trigger called", slog.String("currentState", string(current)), slog.String("event", string(event)))
 
 	var err error
-	var nextState State
-	var handlers []Action[T]
-	transitionFound := false
-
-	// TODO: Optimize this lookup with a map
-	// maybe `map[State]map[Event]int`
-	// the index can point to the transition in the slice
-	for _, transition := range f.transitions {
-		if transition.From == f.currentState && transition.Event == event {
-			nextState = transition.To
-			handlers = transition.Action
-			transitionFound = true
-			break
+	transitions, rejected := f.selectTransitions(ctx, event, args)
+	transitionFound := len(transitions) > 0
+
+	if !transitionFound && len(rejected) > 0 {
+		if f.logger.enabled(ctx, slog.LevelDebug) {
+			f.logger.debug(ctx, "All guards rejected the event",
+				slog.String("state", string(current)),
+				slog.String("event", string(event)),
+				slog.Any("guards", rejected))
+		}
+
+		return args, &TransitionError{
+			Message: "no guard passed",
+			State:   current,
+			Event:   event,
+			Err:     ErrGuardRejected,
 		}
 	}
 
 	if !transitionFound {
 		err = &TransitionError{
 			Message: "no transition found",
-			State:   f.currentState,
+			State:   current,
 			Event:   event,
-			Err:     nil,
+			Err:     ErrNoTransition,
 		}
 
-		f.logger.Warn().
-			Str("state", string(f.currentState)).
-			Str("event", string(event)).
-			Msg("No transition found")
+		f.logger.warn(ctx, "No transition found",
+			slog.String("state", string(current)),
+			slog.String("event", string(event)))
 
 		if f.errorHandler != nil || f.errorState != "" {
 			f.handleError(ctx, args, err)
@@ -287,22 +477,274 @@ func (f *FSM[T]) Trigger(ctx context.Context, event Event, args *T) (*T, error)
 		return args, err
 	}
 
-	f.logger.Info().Str("from", string(f.currentState)).Str("to", string(nextState)).Str("event", string(event)).Msg("Transitioning")
+	exited, entered, history := f.plan(transitions)
+	next := f.nextConfiguration(exited, entered)
+
+	to := f.states.commonAncestor(next)
+	f.logger.info(ctx, "Transitioning", slog.String("from", string(current)), slog.String("to", string(to)), slog.String("event", string(event)))
+
+	start := f.Clock.Now()
+	notification := Notification{Kind: BeforeTransition, ID: f.id, Event: event, From: current, To: to}
+	f.notify(notification)
+
+	if args, err = f.runStep(ctx, event, transitions, exited, entered, args); err != nil {
+		notification.Kind, notification.Duration, notification.Err = TransitionFailed, f.Clock.Now().Sub(start), err
+		f.notify(notification)
+		return args, err
+	}
+
+	for state, remembered := range history {
+		f.history[state] = remembered
+	}
+	f.active = next
+	f.updateTimers(exited, entered, args)
+	f.trackStates(exited, entered)
+
+	notification.Kind, notification.Duration = AfterTransition, f.Clock.Now().Sub(start)
+	f.notify(notification)
+
+	if f.logger.enabled(ctx, slog.LevelInfo) {
+		f.logger.info(ctx, "Transition completed", slog.String("newState", string(f.current())))
+	}
+
+	return args, nil
+}
+
+// runStep runs the exit hooks of the exited states, the actions of the transitions and the
+// entry hooks of the entered states, stopping at the first failure.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) runStep(ctx context.Context, event Event, transitions []*Transition[T], exited, entered []State, args *T) (*T, error) {
+	var err error
+	for i := len(exited) - 1; i >= 0; i-- {
+		info := ActionInfo{Kind: ActionKindExit, State: exited[i], Event: event}
+		if args, err = f.runActions(ctx, info, f.exitActions[exited[i]], nil, args); err != nil {
+			return args, err
+		}
+	}
+	for _, transition := range transitions {
+		info := ActionInfo{
+			Kind:  ActionKindTransition,
+			State: transition.From,
+			Event: event,
+			From:  transition.From,
+			To:    transition.To,
+			Guard: transition.Guard.Name,
+		}
+		if args, err = f.runActions(ctx, info, transition.Action, transition.Middleware, args); err != nil {
+			return args, err
+		}
+	}
+	for _, state := range entered {
+		info := ActionInfo{Kind: ActionKindEntry, State: state, Event: event}
+		if args, err = f.runActions(ctx, info, f.entryActions[state], nil, args); err != nil {
+			return args, err
+		}
+	}
+	return args, nil
+}
+
+// selectTransitions finds the transitions to take for an event. Each active leaf is offered
+// the event in document order, first itself and then each of its ancestors; within a state
+// transitions are tried in registration order and the first one whose guard passes wins.
+// Transitions whose exit sets overlap conflict, and only one of them is kept.
+// The names of guards that rejected the event are returned alongside.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) selectTransitions(ctx context.Context, event Event, args *T) ([]*Transition[T], []string) {
+	var selected []*Transition[T]
+	var rejected []string
+
+	for _, leaf := range f.active {
+		transition, rej := f.selectTransition(ctx, leaf, event, args)
+		rejected = append(rejected, rej...)
+		if transition == nil {
+			continue
+		}
+
+		keep := true
+		for i := 0; i < len(selected); i++ {
+			other := selected[i]
+			if other == transition {
+				keep = false
+				break
+			}
+			if !f.conflicts(transition, other) {
+				continue
+			}
+			if !f.states.IsDescendant(transition.From, other.From) {
+				keep = false
+				break
+			}
+			selected = append(selected[:i], selected[i+1:]...)
+			i--
+		}
+		if keep {
+			selected = append(selected, transition)
+		}
+	}
+	return selected, rejected
+}
+
+// selectTransition finds the transition to take for an event starting from one active leaf,
+// looking at the leaf first and then at each of its ancestors.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) selectTransition(ctx context.Context, leaf State, event Event, args *T) (*Transition[T], []string) {
+	var rejected []string
+
+	for state := leaf; state != ""; state = f.states.Parent(state) {
+		for _, i := range f.candidates(state, event) {
+			transition := &f.transitions[i]
+			if !transition.allows(ctx, args) {
+				rejected = append(rejected, transition.Guard.Name)
+				continue
+			}
+			return transition, rejected
+		}
+	}
+	return nil, rejected
+}
+
+// conflicts reports whether two transitions would leave a common state.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) conflicts(a, b *Transition[T]) bool {
+	exitA := f.states.exitSet(f.active, f.states.domain(a.From, a.To))
+	exitB := f.states.exitSet(f.active, f.states.domain(b.From, b.To))
+	for _, x := range exitA {
+		for _, y := range exitB {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// plan returns the states exited and entered by a set of non-conflicting transitions, both in
+// document order, and the history the exited states leave behind. History targets are resolved
+// against that history, so that a transition out of a state and into its own history resumes
+// the configuration it just left.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) plan(transitions []*Transition[T]) (exited, entered []State, history map[State][]State) {
+	seenExit := make(map[State]struct{})
+	seenEntry := make(map[State]struct{})
+	for _, transition := range transitions {
+		domain := f.states.domain(transition.From, transition.To)
+		for _, state := range f.states.exitSet(f.active, domain) {
+			if _, ok := seenExit[state]; !ok {
+				seenExit[state] = struct{}{}
+				exited = append(exited, state)
+			}
+		}
+	}
+	history = f.exitHistory(exited)
+	for _, transition := range transitions {
+		domain := f.states.domain(transition.From, transition.To)
+		for _, state := range f.states.entrySet(domain, f.resolveTargets(transition.To, history)) {
+			if _, ok := seenEntry[state]; !ok {
+				seenEntry[state] = struct{}{}
+				entered = append(entered, state)
+			}
+		}
+	}
+	f.states.sortDocument(exited)
+	f.states.sortDocument(entered)
+	return exited, entered, history
+}
+
+// resolveTargets returns the states a transition into target actually enters. A history
+// pseudo-state resolves to what its parent last remembered, looking at the history recorded by
+// the transition itself first, or to the parent itself if nothing was remembered yet.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) resolveTargets(target State, history map[State][]State) []State {
+	if !f.states.IsHistory(target) {
+		return []State{target}
+	}
+	remembered, ok := history[target]
+	if !ok {
+		remembered = f.history[target]
+	}
+	if len(remembered) > 0 {
+		return remembered
+	}
+	return []State{f.states.Parent(target)}
+}
+
+// exitHistory returns, for every history pseudo-state of the exited states, which of the
+// descendants of its parent are active before they are exited.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) exitHistory(exited []State) map[State][]State {
+	var recorded map[State][]State
+	var active []State
+	for _, state := range exited {
+		for _, history := range f.states.Histories(state) {
+			if recorded == nil {
+				recorded = make(map[State][]State)
+				active = f.states.active(f.active)
+			}
+			var remembered []State
+			for _, st := range active {
+				switch f.states.HistoryKind(history) {
+				case HistoryShallow:
+					if f.states.Parent(st) == state {
+						remembered = append(remembered, st)
+					}
+				case HistoryDeep:
+					if f.states.IsDescendant(st, state) && len(f.states.Children(st)) == 0 {
+						remembered = append(remembered, st)
+					}
+				}
+			}
+			recorded[history] = remembered
+		}
+	}
+	return recorded
+}
+
+// nextConfiguration returns the active leaves after leaving the exited states and
+// entering the entered ones.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) nextConfiguration(exited, entered []State) []State {
+	left := make(map[State]struct{}, len(exited))
+	for _, state := range exited {
+		left[state] = struct{}{}
+	}
+	var next []State
+	for _, leaf := range f.active {
+		if _, ok := left[leaf]; !ok {
+			next = append(next, leaf)
+		}
+	}
+	next = append(next, f.states.leaves(entered)...)
+	f.states.sortDocument(next)
+	return next
+}
+
+// current returns the innermost state that contains the whole active configuration.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) current() State {
+	return f.states.commonAncestor(f.active)
+}
 
-	for _, handler := range handlers {
+// runActions executes the given actions in order, passing the result of each to the next.
+// Each action is wrapped in the machine middleware, then in the given transition middleware.
+// If an action is nil or fails, the error handler is invoked and the error is returned.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) runActions(ctx context.Context, info ActionInfo, actions []Action[T], middleware []Middleware[T], args *T) (*T, error) {
+	var err error
+	event := info.Event
+	current := f.current()
+	for _, handler := range actions {
 		if handler.Fn == nil {
 			err = &TransitionError{
 				Message: "no handler function defined",
-				State:   f.currentState,
+				State:   current,
 				Event:   event,
 				Err:     nil,
 			}
 
-			f.logger.Error().
-				Str("action", handler.Name).
-				Str("state", string(f.currentState)).
-				Str("event", string(event)).
-				Msg("Handler function is nil")
+			f.logger.error(ctx, "Handler function is nil",
+				slog.String("action", handler.Name),
+				slog.String("state", string(current)),
+				slog.String("event", string(event)))
 
 			if f.errorHandler != nil || f.errorState != "" {
 				f.handleError(ctx, args, err)
@@ -310,14 +752,15 @@ func (f *FSM[T]) Trigger(ctx context.Context, event Event, args *T) (*T, error)
 			return args, err
 		}
 
-		f.logger.Debug().Str("action", handler.Name).Str("state", string(f.currentState)).Str("event", string(event)).Msg("Executing action")
+		f.logger.debug(ctx, "Executing action", slog.String("action", handler.Name), slog.String("state", string(current)), slog.String("event", string(event)))
 
-		if args, err = handler.Fn(ctx, args); err != nil {
-			f.logger.Error().Err(err).
-				Str("action", handler.Name).
-				Str("state", string(f.currentState)).
-				Str("event", string(event)).
-				Msg("Action failed")
+		info.Action = handler.Name
+		if args, err = f.invoke(ctx, info, handler, middleware, args); err != nil {
+			f.logger.error(ctx, "Action failed",
+				errAttr(err),
+				slog.String("action", handler.Name),
+				slog.String("state", string(current)),
+				slog.String("event", string(event)))
 
 			if f.errorHandler != nil || f.errorState != "" {
 				f.handleError(ctx, args, err)
@@ -325,54 +768,116 @@ func (f *FSM[T]) Trigger(ctx context.Context, event Event, args *T) (*T, error)
 			return args, err
 		}
 
-		f.logger.Debug().Str("action", handler.Name).Msg("Action completed")
+		f.logger.debug(ctx, "Action completed", slog.String("action", handler.Name))
 	}
-
-	f.currentState = nextState
-
-	f.logger.Info().Str("newState", string(f.currentState)).Msg("Transition completed")
-
 	return args, nil
 }
 
+// invoke runs a single action inside its middleware chain and notes it in the journal entry
+// being recorded. While replaying, the action is stood in for instead of being run, and no
+// middleware runs.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) invoke(ctx context.Context, info ActionInfo, handler Action[T], middleware []Middleware[T], args *T) (*T, error) {
+	var err error
+	if f.replay != nil {
+		args, err = f.replay.invoke(handler, args, f.recording)
+	} else {
+		fn := chain(handler.Fn, handler.Middleware)
+		fn = chain(fn, middleware)
+		fn = chain(fn, f.middleware)
+		var start time.Time
+		if f.Metrics != nil {
+			start = f.Clock.Now()
+		}
+		actionCtx, end := f.traceAction(ctx, info)
+		args, err = fn(context.WithValue(actionCtx, actionInfoKey{}, info), args)
+		end(err)
+		if f.Metrics != nil {
+			f.Metrics.ObserveAction(handler.Name, f.Clock.Now().Sub(start))
+		}
+	}
+	if f.recording != nil {
+		f.recording.Actions = append(f.recording.Actions, handler.Name)
+	}
+	return args, err
+}
+
 // handleError is called when an error occurs during a transition.
 // It executes the error handler and transitions to the error state.
+// While replaying, only the move to the error state happens.
 // NOTE: Should be called with the lock
 func (f *FSM[T]) handleError(ctx context.Context, args *T, originalErr error) {
-	if f.errorHandler != nil {
+	if f.errorHandler != nil && f.replay == nil {
 		_, err := f.errorHandler(ctx, args)
 		if err != nil {
-			ev := f.logger.Error().Err(err)
+			attrs := []slog.Attr{errAttr(err)}
 			if originalErr != nil {
-				ev = ev.Str("originalError", originalErr.Error())
+				attrs = append(attrs, slog.String("originalError", originalErr.Error()))
 			}
-			ev.Msg("Error in FSM error handler")
+			f.logger.error(ctx, "Error in FSM error handler", attrs...)
 		}
 	}
 	if f.errorState != "" {
-		f.currentState = f.errorState
+		before := f.active
+		f.active = f.states.defaultLeaves(f.errorState)
+		f.resetTimers(args)
+		f.trackJump(before)
 	}
 }
 
 // GetState returns the current state of the FSM.
+// With nested states this is the innermost active state. When parallel regions are active it
+// is the innermost state containing all of them; use Configuration to see every active state.
 func (f *FSM[T]) GetState() State {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-	return f.currentState
+	return f.current()
+}
+
+// Configuration returns every active state, including the ancestors of the active leaves,
+// in document order.
+func (f *FSM[T]) Configuration() []State {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.states.active(f.active)
+}
+
+// IsIn reports whether the FSM is in the given state, either directly or
+// because an active state is nested inside it.
+func (f *FSM[T]) IsIn(state State) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, leaf := range f.active {
+		if leaf == state || f.states.IsDescendant(leaf, state) {
+			return true
+		}
+	}
+	return false
 }
 
 // SetState sets the current state of the FSM.
+// If the state has substates, its initial substates or all of its regions become active too.
 //
 // WARN: This bypasses the normal transition mechanism.
 func (f *FSM[T]) SetState(s State) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	f.logger.Warn().
-		Str("oldState", string(f.currentState)).
-		Str("newState", string(s)).
-		Msg("State manually set (bypassing transitions)")
-	f.currentState = s
+	f.logger.warn(context.Background(), "State manually set (bypassing transitions)",
+		slog.String("oldState", string(f.current())),
+		slog.String("newState", string(s)))
+	before := f.active
+	f.active = f.states.defaultLeaves(s)
+	f.started = true
+	f.resetTimers(nil)
+	f.trackJump(before)
+}
+
+// Use wraps every action and hook of the FSM in mw. See Definition.Use.
+func (f *FSM[T]) Use(mw ...Middleware[T]) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Definition.Use(mw...)
 }
 
 // SetErrorHandler configures an error handler and error state.
@@ -381,6 +886,5 @@ func (f *FSM[T]) SetState(s State) {
 func (f *FSM[T]) SetErrorHandler(errorState State, handler ActionFunc[T]) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.errorState = errorState
-	f.errorHandler = handler
+	f.Definition.SetErrorHandler(errorState, handler)
 }
@@ -3,7 +3,9 @@ package nexus
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -263,3 +265,552 @@ func TestTransitionError_Error(t *testing.T) {
 	expectedMsg := "transition error in state 'test_state' on event 'test_event': test error: underlying error"
 	assert.Equal(t, expectedMsg, errorMsg)
 }
+
+func TestFSM_Trigger_GuardSelectsTransition(t *testing.T) {
+	fsm := New[TestData](State("review"))
+	fsm.RegisterState(State("approved"))
+	fsm.RegisterState(State("rejected"))
+
+	event := Event("decide")
+	fsm.AddTransition(State("review"), State("approved"), event, nil,
+		WithGuard("high_score", func(ctx context.Context, args *TestData) bool {
+			return args.Counter >= 10
+		}))
+	fsm.AddTransition(State("review"), State("rejected"), event, nil,
+		WithGuard("low_score", func(ctx context.Context, args *TestData) bool {
+			return args.Counter < 10
+		}))
+
+	_, err := fsm.Trigger(context.Background(), event, &TestData{Counter: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, State("rejected"), fsm.GetState())
+
+	fsm.SetState(State("review"))
+	_, err = fsm.Trigger(context.Background(), event, &TestData{Counter: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, State("approved"), fsm.GetState())
+}
+
+func TestFSM_Trigger_GuardRejected(t *testing.T) {
+	fsm := New[TestData](State("state1"))
+	state2 := State("state2")
+	errorState := State("error_state")
+	fsm.RegisterState(state2)
+	fsm.RegisterState(errorState)
+
+	errorHandlerCalled := false
+	fsm.SetErrorHandler(errorState, func(ctx context.Context, args *TestData) (*TestData, error) {
+		errorHandlerCalled = true
+		return args, nil
+	})
+
+	actionCalled := false
+	event := Event("go")
+	fsm.AddTransition(State("state1"), state2, event, []Action[TestData]{{
+		Name: "Mark",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			actionCalled = true
+			return args, nil
+		},
+	}}, WithGuard("never", func(ctx context.Context, args *TestData) bool {
+		return false
+	}))
+
+	_, err := fsm.Trigger(context.Background(), event, &TestData{})
+	assert.ErrorIs(t, err, ErrGuardRejected)
+
+	var transErr *TransitionError
+	assert.ErrorAs(t, err, &transErr)
+	assert.Equal(t, State("state1"), transErr.State)
+	assert.Equal(t, event, transErr.Event)
+
+	assert.False(t, actionCalled)
+	assert.False(t, errorHandlerCalled)
+	assert.Equal(t, State("state1"), fsm.GetState())
+}
+
+func TestFSM_EntryExitHooks_Order(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	fsm.RegisterState(State("processing"))
+
+	var calls []string
+	record := func(name string) Action[TestData] {
+		return Action[TestData]{
+			Name: name,
+			Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+				calls = append(calls, name)
+				return args, nil
+			},
+		}
+	}
+
+	assert.NoError(t, fsm.OnExit(State("idle"), record("exit_idle")))
+	assert.NoError(t, fsm.OnEnter(State("processing"), record("enter_processing")))
+	fsm.AddTransition(State("idle"), State("processing"), Event("start"), []Action[TestData]{record("transition")})
+
+	_, err := fsm.Trigger(context.Background(), Event("start"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"exit_idle", "transition", "enter_processing"}, calls)
+	assert.Equal(t, State("processing"), fsm.GetState())
+}
+
+func TestFSM_EntryHookFailure(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	fsm.RegisterState(State("processing"))
+	errorState := State("error_state")
+	fsm.RegisterState(errorState)
+	fsm.SetErrorHandler(errorState, nil)
+
+	expectedError := errors.New("timer failed")
+	assert.NoError(t, fsm.OnEnter(State("processing"), Action[TestData]{
+		Name: "start_timer",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			return args, expectedError
+		},
+	}))
+	fsm.AddTransition(State("idle"), State("processing"), Event("start"), nil)
+
+	_, err := fsm.Trigger(context.Background(), Event("start"), &TestData{})
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, errorState, fsm.GetState())
+}
+
+func TestFSM_Hooks_UnregisteredState(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	err := fsm.OnEnter(State("missing"))
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+	err = fsm.OnExit(State("missing"))
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+}
+
+func TestFSM_NestedStates_EventBubblesToParent(t *testing.T) {
+	fsm := New[TestData](State("new"))
+	assert.NoError(t, fsm.RegisterState(State("fulfilment")))
+	assert.NoError(t, fsm.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("packing"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("cancelled")))
+
+	fsm.AddTransition(State("new"), State("fulfilment"), Event("pay"), nil)
+	fsm.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	fsm.AddTransition(State("fulfilment"), State("cancelled"), Event("cancel"), nil)
+
+	ctx := context.Background()
+	_, err := fsm.Trigger(ctx, Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("picking"), fsm.GetState())
+	assert.True(t, fsm.IsIn(State("fulfilment")))
+
+	_, err = fsm.Trigger(ctx, Event("picked"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("packing"), fsm.GetState())
+
+	_, err = fsm.Trigger(ctx, Event("cancel"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("cancelled"), fsm.GetState())
+	assert.False(t, fsm.IsIn(State("fulfilment")))
+}
+
+func TestFSM_NestedStates_CompoundInitialState(t *testing.T) {
+	fsm := New[TestData](State("root"))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("root"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("root"))))
+	fsm.AddTransition(State("a"), State("b"), Event("go"), nil)
+
+	assert.Equal(t, State("a"), fsm.GetState())
+	assert.Equal(t, []State{"root", "a"}, fsm.Configuration())
+
+	_, err := fsm.Trigger(context.Background(), Event("go"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"root", "b"}, fsm.Configuration())
+
+	// Once the machine has left its initial configuration, new substates do not move it.
+	assert.NoError(t, fsm.RegisterState(State("c"), WithParent(State("b"))))
+	assert.Equal(t, State("b"), fsm.GetState())
+}
+
+func TestFSM_NestedStates_BackInInitialState(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("root"), WithClock(clock))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("root")),
+		WithTimeout(time.Minute, Event("expire"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("root"))))
+	fsm.AddTransition(State("a"), State("b"), Event("go"), nil)
+	fsm.AddTransition(State("b"), State("a"), Event("back"), nil)
+	fsm.AddTransition(State("a"), State("b"), Event("expire"), nil)
+
+	ctx := context.Background()
+	for _, e := range []Event{"go", "back"} {
+		_, err := fsm.Trigger(ctx, e, &TestData{})
+		assert.NoError(t, err)
+	}
+	clock.Advance(40 * time.Second)
+
+	// Back in the initial leaves after running: registering does not restart the timeout.
+	assert.NoError(t, fsm.RegisterState(State("c"), WithParent(State("root"))))
+	clock.Advance(20 * time.Second)
+	assert.Equal(t, State("b"), fsm.GetState())
+}
+
+func TestFSM_NestedStates_ParallelInitialState(t *testing.T) {
+	fsm := New[TestData](State("root"))
+	assert.NoError(t, fsm.RegisterState(State("tracking"), WithParent(State("root")), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("carrier"), WithParent(State("tracking"))))
+	assert.NoError(t, fsm.RegisterState(State("customer"), WithParent(State("tracking"))))
+
+	assert.Equal(t, []State{"root", "tracking", "carrier", "customer"}, fsm.Configuration())
+}
+
+func TestFSM_NestedStates_EntryExitOrder(t *testing.T) {
+	fsm := New[TestData](State("new"))
+	fsm.RegisterState(State("fulfilment"))
+	fsm.RegisterState(State("picking"), WithParent(State("fulfilment")))
+	fsm.RegisterState(State("packing"), WithParent(State("fulfilment")))
+	fsm.RegisterState(State("cancelled"))
+
+	var calls []string
+	record := func(name string) Action[TestData] {
+		return Action[TestData]{
+			Name: name,
+			Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+				calls = append(calls, name)
+				return args, nil
+			},
+		}
+	}
+	for _, s := range []State{"new", "fulfilment", "picking", "packing", "cancelled"} {
+		assert.NoError(t, fsm.OnEnter(s, record("enter_"+string(s))))
+		assert.NoError(t, fsm.OnExit(s, record("exit_"+string(s))))
+	}
+
+	fsm.AddTransition(State("new"), State("fulfilment"), Event("pay"), nil)
+	fsm.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	fsm.AddTransition(State("fulfilment"), State("cancelled"), Event("cancel"), nil)
+
+	ctx := context.Background()
+	fsm.Trigger(ctx, Event("pay"), &TestData{})
+	assert.Equal(t, []string{"exit_new", "enter_fulfilment", "enter_picking"}, calls)
+
+	calls = nil
+	fsm.Trigger(ctx, Event("picked"), &TestData{})
+	assert.Equal(t, []string{"exit_picking", "enter_packing"}, calls)
+
+	calls = nil
+	fsm.Trigger(ctx, Event("cancel"), &TestData{})
+	assert.Equal(t, []string{"exit_packing", "exit_fulfilment", "enter_cancelled"}, calls)
+}
+
+func TestFSM_RegisterState_UnknownParent(t *testing.T) {
+	fsm := New[TestData](State("initial"))
+	err := fsm.RegisterState(State("child"), WithParent(State("missing")))
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+	assert.False(t, fsm.states.Exists(State("child")))
+}
+
+func TestFSM_Parallel_EntersAllRegions(t *testing.T) {
+	fsm := New[TestData](State("boot"))
+	assert.NoError(t, fsm.RegisterState(State("device"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("power"), WithParent(State("device"))))
+	assert.NoError(t, fsm.RegisterState(State("battery"), WithParent(State("power"))))
+	assert.NoError(t, fsm.RegisterState(State("mains"), WithParent(State("power"))))
+	assert.NoError(t, fsm.RegisterState(State("connectivity"), WithParent(State("device"))))
+	assert.NoError(t, fsm.RegisterState(State("offline"), WithParent(State("connectivity"))))
+	assert.NoError(t, fsm.RegisterState(State("online"), WithParent(State("connectivity"))))
+	assert.NoError(t, fsm.RegisterState(State("off")))
+
+	fsm.AddTransition(State("boot"), State("device"), Event("start"), nil)
+	fsm.AddTransition(State("battery"), State("mains"), Event("plug"), nil)
+	fsm.AddTransition(State("offline"), State("online"), Event("connect"), nil)
+	fsm.AddTransition(State("device"), State("off"), Event("shutdown"), nil)
+
+	_, err := fsm.Trigger(context.Background(), Event("start"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("device"), fsm.GetState())
+	assert.Equal(t, []State{"device", "power", "battery", "connectivity", "offline"}, fsm.Configuration())
+
+	_, err = fsm.Trigger(context.Background(), Event("connect"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"device", "power", "battery", "connectivity", "online"}, fsm.Configuration())
+	assert.True(t, fsm.IsIn(State("battery")))
+	assert.True(t, fsm.IsIn(State("online")))
+
+	_, err = fsm.Trigger(context.Background(), Event("shutdown"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"off"}, fsm.Configuration())
+}
+
+func TestFSM_Parallel_EventDispatchedToEveryRegion(t *testing.T) {
+	fsm := New[TestData](State("boot"))
+	assert.NoError(t, fsm.RegisterState(State("device"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("power"), WithParent(State("device"))))
+	assert.NoError(t, fsm.RegisterState(State("battery"), WithParent(State("power"))))
+	assert.NoError(t, fsm.RegisterState(State("mains"), WithParent(State("power"))))
+	assert.NoError(t, fsm.RegisterState(State("connectivity"), WithParent(State("device"))))
+	assert.NoError(t, fsm.RegisterState(State("offline"), WithParent(State("connectivity"))))
+	assert.NoError(t, fsm.RegisterState(State("online"), WithParent(State("connectivity"))))
+	assert.NoError(t, fsm.RegisterState(State("off")))
+
+	fsm.AddTransition(State("boot"), State("device"), Event("start"), nil)
+	fsm.AddTransition(State("battery"), State("mains"), Event("plug"), nil)
+	fsm.AddTransition(State("offline"), State("online"), Event("connect"), nil)
+	fsm.AddTransition(State("device"), State("off"), Event("shutdown"), nil)
+	fsm.AddTransition(State("mains"), State("battery"), Event("outage"), nil)
+	fsm.AddTransition(State("online"), State("offline"), Event("outage"), nil)
+
+	var calls []string
+	record := func(name string) Action[TestData] {
+		return Action[TestData]{
+			Name: name,
+			Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+				calls = append(calls, name)
+				return args, nil
+			},
+		}
+	}
+	for _, s := range []State{"battery", "mains", "offline", "online"} {
+		assert.NoError(t, fsm.OnEnter(s, record("enter_"+string(s))))
+		assert.NoError(t, fsm.OnExit(s, record("exit_"+string(s))))
+	}
+
+	ctx := context.Background()
+	fsm.Trigger(ctx, Event("start"), &TestData{})
+	fsm.Trigger(ctx, Event("plug"), &TestData{})
+	fsm.Trigger(ctx, Event("connect"), &TestData{})
+
+	calls = nil
+	_, err := fsm.Trigger(ctx, Event("outage"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"device", "power", "battery", "connectivity", "offline"}, fsm.Configuration())
+	assert.Equal(t, []string{"exit_online", "exit_mains", "enter_battery", "enter_offline"}, calls)
+}
+
+func TestFSM_Parallel_ErrorAbortsStep(t *testing.T) {
+	fsm := New[TestData](State("boot"))
+	assert.NoError(t, fsm.RegisterState(State("device"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("power"), WithParent(State("device"))))
+	assert.NoError(t, fsm.RegisterState(State("battery"), WithParent(State("power"))))
+	assert.NoError(t, fsm.RegisterState(State("mains"), WithParent(State("power"))))
+	assert.NoError(t, fsm.RegisterState(State("connectivity"), WithParent(State("device"))))
+	assert.NoError(t, fsm.RegisterState(State("offline"), WithParent(State("connectivity"))))
+	assert.NoError(t, fsm.RegisterState(State("online"), WithParent(State("connectivity"))))
+	assert.NoError(t, fsm.RegisterState(State("off")))
+
+	fsm.AddTransition(State("boot"), State("device"), Event("start"), nil)
+	fsm.AddTransition(State("battery"), State("mains"), Event("plug"), nil)
+	fsm.AddTransition(State("offline"), State("online"), Event("connect"), nil)
+	fsm.AddTransition(State("device"), State("off"), Event("shutdown"), nil)
+	fsm.AddTransition(State("mains"), State("battery"), Event("outage"), nil)
+
+	expectedError := errors.New("link down")
+	fsm.AddTransition(State("online"), State("offline"), Event("outage"), []Action[TestData]{{
+		Name: "notify",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			return args, expectedError
+		},
+	}})
+
+	ctx := context.Background()
+	fsm.Trigger(ctx, Event("start"), &TestData{})
+	fsm.Trigger(ctx, Event("plug"), &TestData{})
+	fsm.Trigger(ctx, Event("connect"), &TestData{})
+
+	_, err := fsm.Trigger(ctx, Event("outage"), &TestData{})
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, []State{"device", "power", "mains", "connectivity", "online"}, fsm.Configuration())
+}
+
+func TestFSM_History_Shallow(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	assert.NoError(t, fsm.RegisterState(State("work")))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b1"), WithParent(State("b"))))
+	assert.NoError(t, fsm.RegisterState(State("b2"), WithParent(State("b"))))
+	assert.NoError(t, fsm.RegisterState(State("work_history"), WithParent(State("work")), WithHistory(HistoryShallow)))
+	assert.NoError(t, fsm.RegisterState(State("paused")))
+
+	fsm.AddTransition(State("idle"), State("work"), Event("start"), nil)
+	fsm.AddTransition(State("a"), State("b"), Event("next"), nil)
+	fsm.AddTransition(State("b1"), State("b2"), Event("next"), nil)
+	fsm.AddTransition(State("work"), State("paused"), Event("pause"), nil)
+	fsm.AddTransition(State("paused"), State("work_history"), Event("resume"), nil)
+	ctx := context.Background()
+
+	for _, e := range []Event{"start", "next", "next", "pause"} {
+		_, err := fsm.Trigger(ctx, e, &TestData{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, State("paused"), fsm.GetState())
+
+	_, err := fsm.Trigger(ctx, Event("resume"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("b1"), fsm.GetState())
+}
+
+func TestFSM_History_Deep(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	assert.NoError(t, fsm.RegisterState(State("work")))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b1"), WithParent(State("b"))))
+	assert.NoError(t, fsm.RegisterState(State("b2"), WithParent(State("b"))))
+	assert.NoError(t, fsm.RegisterState(State("work_history"), WithParent(State("work")), WithHistory(HistoryDeep)))
+	assert.NoError(t, fsm.RegisterState(State("paused")))
+
+	fsm.AddTransition(State("idle"), State("work"), Event("start"), nil)
+	fsm.AddTransition(State("a"), State("b"), Event("next"), nil)
+	fsm.AddTransition(State("b1"), State("b2"), Event("next"), nil)
+	fsm.AddTransition(State("work"), State("paused"), Event("pause"), nil)
+	fsm.AddTransition(State("paused"), State("work_history"), Event("resume"), nil)
+	ctx := context.Background()
+
+	for _, e := range []Event{"start", "next", "next", "pause"} {
+		_, err := fsm.Trigger(ctx, e, &TestData{})
+		assert.NoError(t, err)
+	}
+
+	_, err := fsm.Trigger(ctx, Event("resume"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("b2"), fsm.GetState())
+}
+
+func TestFSM_History_DefaultsToInitial(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	assert.NoError(t, fsm.RegisterState(State("work")))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b1"), WithParent(State("b"))))
+	assert.NoError(t, fsm.RegisterState(State("b2"), WithParent(State("b"))))
+	assert.NoError(t, fsm.RegisterState(State("work_history"), WithParent(State("work")), WithHistory(HistoryDeep)))
+	assert.NoError(t, fsm.RegisterState(State("paused")))
+
+	fsm.AddTransition(State("idle"), State("work"), Event("start"), nil)
+	fsm.AddTransition(State("a"), State("b"), Event("next"), nil)
+	fsm.AddTransition(State("b1"), State("b2"), Event("next"), nil)
+	fsm.AddTransition(State("work"), State("paused"), Event("pause"), nil)
+	fsm.AddTransition(State("paused"), State("work_history"), Event("resume"), nil)
+	fsm.AddTransition(State("idle"), State("work_history"), Event("resume"), nil)
+
+	_, err := fsm.Trigger(context.Background(), Event("resume"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("a"), fsm.GetState())
+}
+
+func TestFSM_History_OwnHistoryResumesLeftConfiguration(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	assert.NoError(t, fsm.RegisterState(State("work")))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("work"))))
+	assert.NoError(t, fsm.RegisterState(State("work_history"), WithParent(State("work")), WithHistory(HistoryShallow)))
+	assert.NoError(t, fsm.RegisterState(State("paused")))
+	fsm.AddTransition(State("idle"), State("work"), Event("start"), nil)
+	fsm.AddTransition(State("a"), State("b"), Event("next"), nil)
+	fsm.AddTransition(State("work"), State("paused"), Event("pause"), nil)
+	fsm.AddTransition(State("paused"), State("work_history"), Event("resume"), nil)
+	fsm.AddTransition(State("work"), State("work_history"), Event("refresh"), nil)
+
+	ctx := context.Background()
+	for _, e := range []Event{"start", "pause", "resume", "next", "refresh"} {
+		_, err := fsm.Trigger(ctx, e, &TestData{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, State("b"), fsm.GetState())
+}
+
+func TestFSM_History_RequiresParent(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	err := fsm.RegisterState(State("h"), WithHistory(HistoryShallow))
+	assert.ErrorIs(t, err, ErrInvalidHistory)
+}
+
+func TestFSM_TransitionIndex_KeepsDefinitionOrder(t *testing.T) {
+	fsm := New[TestData](State("a"))
+	for _, s := range []State{"b", "c", "d"} {
+		assert.NoError(t, fsm.RegisterState(s))
+	}
+	never := func(ctx context.Context, args *TestData) bool { return false }
+	fsm.AddTransition(State("a"), State("b"), Event("go"), nil, WithGuard("never", never))
+	fsm.AddTransition(State("b"), State("a"), Event("go"), nil)
+	fsm.AddTransition(State("a"), State("c"), Event("go"), nil)
+	fsm.AddTransition(State("a"), State("d"), Event("go"), nil)
+
+	assert.Equal(t, []int{0, 2, 3}, fsm.candidates(State("a"), Event("go")))
+	_, err := fsm.Trigger(context.Background(), Event("go"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("c"), fsm.GetState())
+}
+
+// linearSelect is the lookup Trigger used before transitions were indexed, kept to compare
+// against in benchmarks.
+func linearSelect(f *FSM[TestData], leaf State, event Event) *Transition[TestData] {
+	for state := leaf; state != ""; state = f.states.Parent(state) {
+		for i := range f.transitions {
+			if t := &f.transitions[i]; t.From == state && t.Event == event {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+func BenchmarkFSM_Trigger(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprintf("states=%d", n), func(b *testing.B) {
+			fsm := New[TestData](State("s0"), WithLogLevel(LevelOff))
+			for i := 1; i < n; i++ {
+				if err := fsm.RegisterState(State(fmt.Sprintf("s%d", i))); err != nil {
+					b.Fatal(err)
+				}
+			}
+			for i := 0; i < n; i++ {
+				from, to := State(fmt.Sprintf("s%d", i)), State(fmt.Sprintf("s%d", (i+1)%n))
+				for _, event := range []Event{"reset", "pause", "resume"} {
+					fsm.AddTransition(from, State("s0"), event, nil)
+				}
+				fsm.AddTransition(from, to, Event("next"), nil)
+			}
+			ctx, data := context.Background(), &TestData{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := fsm.Trigger(ctx, Event("next"), data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFSM_SelectTransition(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		fsm := New[TestData](State("s0"), WithLogLevel(LevelOff))
+		for i := 1; i < n; i++ {
+			if err := fsm.RegisterState(State(fmt.Sprintf("s%d", i))); err != nil {
+				b.Fatal(err)
+			}
+		}
+		for i := 0; i < n; i++ {
+			from, to := State(fmt.Sprintf("s%d", i)), State(fmt.Sprintf("s%d", (i+1)%n))
+			for _, event := range []Event{"reset", "pause", "resume"} {
+				fsm.AddTransition(from, State("s0"), event, nil)
+			}
+			fsm.AddTransition(from, to, Event("next"), nil)
+		}
+		ctx, data := context.Background(), &TestData{}
+		leaves := fsm.states.Keys()
+
+		b.Run(fmt.Sprintf("indexed/states=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if t, _ := fsm.selectTransition(ctx, leaves[i%n], Event("next"), data); t == nil {
+					b.Fatal("no transition")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("linear/states=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if linearSelect(fsm, leaves[i%n], Event("next")) == nil {
+					b.Fatal("no transition")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Outcome is how processing an event ended.
+type Outcome string
+
+const (
+	// OutcomeOK means the transition completed.
+	OutcomeOK Outcome = "ok"
+	// OutcomeNoTransition means no transition was registered for the event.
+	OutcomeNoTransition Outcome = "no_transition"
+	// OutcomeRejected means every guard rejected the event.
+	OutcomeRejected Outcome = "rejected"
+	// OutcomeFailed means an action or hook failed.
+	OutcomeFailed Outcome = "failed"
+)
+
+// outcomeOf classifies the error returned by a step.
+func outcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, ErrGuardRejected):
+		return OutcomeRejected
+	case errors.Is(err, ErrNoTransition):
+		return OutcomeNoTransition
+	default:
+		return OutcomeFailed
+	}
+}
+
+// JournalEntry records one event processed by an FSM. Events raised by actions and fired by
+// timeouts get entries of their own.
+type JournalEntry struct {
+	// Seq is assigned by the journal and increases with every entry.
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Event Event     `json:"event"`
+	// From and To are the active leaf states before and after the event.
+	From []State `json:"from"`
+	To   []State `json:"to"`
+	// Actions lists the hooks and actions that ran, in order. When the outcome is
+	// OutcomeFailed, the last one is the action that failed.
+	Actions []string `json:"actions,omitempty"`
+	Outcome Outcome  `json:"outcome"`
+	Error   string   `json:"error,omitempty"`
+	// Args is the JSON encoding of the args the event was processed with, if they could be
+	// encoded. Replay decodes them for guards.
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// Journal is an append-only log of journal entries.
+type Journal interface {
+	// Append adds an entry, assigning its sequence number.
+	Append(ctx context.Context, entry JournalEntry) error
+	// Entries returns every entry in the order they were appended.
+	Entries(ctx context.Context) ([]JournalEntry, error)
+}
+
+// MemoryJournal is a Journal kept in memory.
+type MemoryJournal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+}
+
+// NewMemoryJournal creates an empty MemoryJournal.
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{}
+}
+
+// Append adds an entry to the journal.
+func (j *MemoryJournal) Append(ctx context.Context, entry JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry.Seq = uint64(len(j.entries)) + 1
+	j.entries = append(j.entries, entry)
+	return nil
+}
+
+// Entries returns a copy of every entry in the journal.
+func (j *MemoryJournal) Entries(ctx context.Context) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return slices.Clone(j.entries), nil
+}
+
+// beginEntry starts recording the processing of an event.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) beginEntry(event Event, args *T) *JournalEntry {
+	entry := &JournalEntry{
+		Time:  f.Clock.Now(),
+		Event: event,
+		From:  slices.Clone(f.active),
+	}
+	if data, err := json.Marshal(args); err == nil {
+		entry.Args = data
+	}
+	f.recording = entry
+	return entry
+}
+
+// endEntry completes the entry being recorded with the result of the event.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) endEntry(entry *JournalEntry, err error) {
+	f.recording = nil
+	entry.To = slices.Clone(f.active)
+	entry.Outcome = outcomeOf(err)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+}
+
+// appendEntry adds an entry to the journal, or holds it back until the state it led to is
+// saved.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) appendEntry(ctx context.Context, entry JournalEntry) {
+	if f.unsaved != nil {
+		f.unsaved.entries = append(f.unsaved.entries, entry)
+		return
+	}
+	if err := f.Journal.Append(ctx, entry); err != nil {
+		f.logger.error(ctx, "Failed to append journal entry", errAttr(err), slog.String("event", string(entry.Event)))
+	}
+}
+
+// ReplayMode selects how actions are treated while replaying a journal.
+type ReplayMode int
+
+const (
+	// ReplaySkipActions runs no actions or hooks at all; every transition found succeeds.
+	ReplaySkipActions ReplayMode = iota
+	// ReplayRecorded runs no actions or hooks either, but makes the action recorded as failed
+	// fail again, so failures follow the same error path as they originally did.
+	ReplayRecorded
+)
+
+// replayState is what the FSM needs to stand in for actions during a replay.
+type replayState[T any] struct {
+	mode  ReplayMode
+	entry *JournalEntry
+}
+
+// invoke stands in for an action. recording holds the actions replayed so far in this step.
+func (r *replayState[T]) invoke(handler Action[T], args *T, recording *JournalEntry) (*T, error) {
+	if r.mode != ReplayRecorded || r.entry.Outcome != OutcomeFailed {
+		return args, nil
+	}
+	position := len(recording.Actions)
+	last := len(r.entry.Actions) - 1
+	if position == last && r.entry.Actions[last] == handler.Name {
+		return args, fmt.Errorf("%w: %s", ErrReplayedFailure, r.entry.Error)
+	}
+	return args, nil
+}
+
+// Divergence describes the first journal entry whose replay did not match the recording.
+type Divergence struct {
+	// Index is the position of the entry in the replayed slice.
+	Index  int
+	Entry  JournalEntry
+	Reason string
+	// Active, Actions and Outcome are what the replay produced for the entry.
+	Active  []State
+	Actions []string
+	Outcome Outcome
+}
+
+// ReplayReport is the result of a replay.
+type ReplayReport struct {
+	// Replayed is the number of entries replayed without diverging.
+	Replayed int
+	// Divergence is nil if the whole journal replayed identically.
+	Divergence *Divergence
+}
+
+// Replay rebuilds the FSM's state by processing the events of a journal, in order, against its
+// definition. It is meant to be called on a freshly created FSM built with the same states and
+// transitions as the one that recorded the journal.
+//
+// Actions, hooks and the error handler function never run during a replay; guards do, with the
+// recorded args when available or a zero T otherwise. Nothing is journaled or persisted. Replay
+// stops at the first entry whose resulting states, actions or outcome differ from the recording
+// and reports it.
+func (f *FSM[T]) Replay(ctx context.Context, entries []JournalEntry, mode ReplayMode) (*ReplayReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	defer func() {
+		f.replay = nil
+		f.recording = nil
+	}()
+
+	report := &ReplayReport{}
+	for i := range entries {
+		entry := &entries[i]
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		divergence := &Divergence{Index: i, Entry: *entry}
+		if !slices.Equal(f.active, entry.From) {
+			divergence.Reason = "start state differs"
+			divergence.Active = slices.Clone(f.active)
+			report.Divergence = divergence
+			break
+		}
+
+		args := new(T)
+		if len(entry.Args) > 0 {
+			if err := json.Unmarshal(entry.Args, args); err != nil {
+				return report, fmt.Errorf("replaying entry %d: %w", i, err)
+			}
+		}
+
+		f.replay = &replayState[T]{mode: mode, entry: entry}
+		recording := &JournalEntry{}
+		f.recording = recording
+		_, err := f.microstep(ctx, entry.Event, args)
+
+		divergence.Active = slices.Clone(f.active)
+		divergence.Actions = recording.Actions
+		divergence.Outcome = outcomeOf(err)
+		switch {
+		case !slices.Equal(f.active, entry.To):
+			divergence.Reason = "end state differs"
+		case divergence.Outcome != entry.Outcome && (mode == ReplayRecorded || entry.Outcome != OutcomeFailed):
+			divergence.Reason = "outcome differs"
+		case mode == ReplayRecorded && !slices.Equal(recording.Actions, entry.Actions):
+			divergence.Reason = "actions differ"
+		default:
+			report.Replayed++
+			continue
+		}
+		report.Divergence = divergence
+		break
+	}
+
+	if report.Divergence != nil {
+		f.logger.warn(ctx, "Replay diverged", slog.Int("index", report.Divergence.Index), slog.String("reason", report.Divergence.Reason))
+	} else {
+		f.logger.info(ctx, "Replay completed", slog.Int("entries", report.Replayed), slog.String("state", string(f.current())))
+	}
+	return report, nil
+}
@@ -0,0 +1,158 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal_RecordsEntries(t *testing.T) {
+	// The charge action fails for amounts above 100.
+	def := NewDefinition[TestData](State("cart"))
+	assert.NoError(t, def.RegisterState(State("paying")))
+	assert.NoError(t, def.RegisterState(State("paid"), Final()))
+	assert.NoError(t, def.RegisterState(State("failed")))
+	def.SetErrorHandler(State("failed"), func(ctx context.Context, args *TestData) (*TestData, error) {
+		return args, nil
+	})
+	def.AddTransition(State("cart"), State("paying"), Event("checkout"), nil,
+		WithGuard("not_empty", func(ctx context.Context, args *TestData) bool {
+			return args.Counter > 0
+		}))
+	def.AddTransition(State("paying"), State("paid"), Event("charge"), []Action[TestData]{{
+		Name: "Charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			if args.Counter > 100 {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	def.AddTransition(State("failed"), State("cart"), Event("retry"), nil)
+
+	journal := NewMemoryJournal()
+	fsm, err := def.NewInstance("", WithJournal(journal))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	fsm.Trigger(ctx, Event("checkout"), &TestData{Counter: 0})
+	fsm.Trigger(ctx, Event("checkout"), &TestData{Counter: 500})
+	fsm.Trigger(ctx, Event("charge"), &TestData{Counter: 500})
+
+	entries, err := journal.Entries(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, uint64(1), entries[0].Seq)
+	assert.Equal(t, OutcomeRejected, entries[0].Outcome)
+	assert.Equal(t, []State{"cart"}, entries[0].To)
+
+	assert.Equal(t, OutcomeOK, entries[1].Outcome)
+	assert.Equal(t, []State{"cart"}, entries[1].From)
+	assert.Equal(t, []State{"paying"}, entries[1].To)
+
+	assert.Equal(t, OutcomeFailed, entries[2].Outcome)
+	assert.Equal(t, []string{"Charge"}, entries[2].Actions)
+	assert.Equal(t, []State{"failed"}, entries[2].To)
+	assert.Equal(t, "card declined", entries[2].Error)
+}
+
+func TestFSM_Replay_Recorded(t *testing.T) {
+	// The charge action fails for amounts above 100; sideEffects counts how many times
+	// actions really ran.
+	var sideEffects int
+	def := NewDefinition[TestData](State("cart"))
+	assert.NoError(t, def.RegisterState(State("paying")))
+	assert.NoError(t, def.RegisterState(State("paid"), Final()))
+	assert.NoError(t, def.RegisterState(State("failed")))
+	def.SetErrorHandler(State("failed"), func(ctx context.Context, args *TestData) (*TestData, error) {
+		sideEffects++
+		return args, nil
+	})
+	def.AddTransition(State("cart"), State("paying"), Event("checkout"), nil,
+		WithGuard("not_empty", func(ctx context.Context, args *TestData) bool {
+			return args.Counter > 0
+		}))
+	def.AddTransition(State("paying"), State("paid"), Event("charge"), []Action[TestData]{{
+		Name: "Charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			sideEffects++
+			if args.Counter > 100 {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	def.AddTransition(State("failed"), State("cart"), Event("retry"), nil)
+
+	journal := NewMemoryJournal()
+	original, err := def.NewInstance("", WithJournal(journal))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, e := range []Event{"checkout", "charge", "retry", "checkout"} {
+		original.Trigger(ctx, e, &TestData{Counter: 500})
+	}
+	entries, _ := journal.Entries(ctx)
+
+	sideEffects = 0
+	replayed, err := def.NewInstance("", WithJournal(NewMemoryJournal()))
+	assert.NoError(t, err)
+	report, err := replayed.Replay(ctx, entries, ReplayRecorded)
+	assert.NoError(t, err)
+	assert.Nil(t, report.Divergence)
+	assert.Equal(t, 4, report.Replayed)
+	assert.Equal(t, original.GetState(), replayed.GetState())
+	assert.Equal(t, 0, sideEffects)
+}
+
+func TestFSM_Replay_ReportsDivergence(t *testing.T) {
+	// The charge action fails for amounts above 100; sideEffects counts how many times
+	// actions really ran.
+	var sideEffects int
+	def := NewDefinition[TestData](State("cart"))
+	assert.NoError(t, def.RegisterState(State("paying")))
+	assert.NoError(t, def.RegisterState(State("paid"), Final()))
+	assert.NoError(t, def.RegisterState(State("failed")))
+	def.SetErrorHandler(State("failed"), func(ctx context.Context, args *TestData) (*TestData, error) {
+		sideEffects++
+		return args, nil
+	})
+	def.AddTransition(State("cart"), State("paying"), Event("checkout"), nil,
+		WithGuard("not_empty", func(ctx context.Context, args *TestData) bool {
+			return args.Counter > 0
+		}))
+	def.AddTransition(State("paying"), State("paid"), Event("charge"), []Action[TestData]{{
+		Name: "Charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			sideEffects++
+			if args.Counter > 100 {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	def.AddTransition(State("failed"), State("cart"), Event("retry"), nil)
+
+	journal := NewMemoryJournal()
+	original, err := def.NewInstance("", WithJournal(journal))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	original.Trigger(ctx, Event("checkout"), &TestData{Counter: 500})
+	original.Trigger(ctx, Event("charge"), &TestData{Counter: 500})
+	entries, _ := journal.Entries(ctx)
+
+	replayed, err := def.NewInstance("", WithJournal(NewMemoryJournal()))
+	assert.NoError(t, err)
+	report, err := replayed.Replay(ctx, entries, ReplaySkipActions)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Replayed)
+	if assert.NotNil(t, report.Divergence) {
+		assert.Equal(t, 1, report.Divergence.Index)
+		assert.Equal(t, "end state differs", report.Divergence.Reason)
+		assert.Equal(t, []State{"paid"}, report.Divergence.Active)
+	}
+}
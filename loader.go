@@ -0,0 +1,420 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadError reports a problem found while loading a machine definition, with the position in
+// the document it refers to. Line and Column are 1-based, or 0 when unknown.
+type LoadError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Load builds an FSM from a YAML or JSON document. Actions, hooks, guards and the error
+// handler are referred to by name and resolved against registry, or kept as named
+// placeholders if registry is nil. A document looks like:
+//
+//	version: orders-v1
+//	initial: cart
+//	error_state: failed
+//	error_handler: alert
+//	states:
+//	  - name: cart
+//	  - name: awaiting_payment
+//	    timeout: 15m
+//	    timeout_event: payment_timeout
+//	    on_enter: [reserve_stock]
+//	  - name: fulfilment
+//	  - name: picking
+//	    parent: fulfilment
+//	  - name: failed
+//	transitions:
+//	  - from: cart
+//	    to: awaiting_payment
+//	    event: checkout
+//	    guard: not_empty
+//	    actions: [create_invoice]
+//
+// States also accept parallel: true, final: true and history: shallow|deep. A parent must be
+// listed before its children. The initial state may be nested; the FSM starts in it as if it had
+// been entered.
+//
+// Every problem found is reported as a *LoadError; several of them are joined with errors.Join.
+// Options are applied after the document's version, so they can override it.
+func Load[T any](r io.Reader, registry *Registry[T], opts ...FSMOptionFunc) (*FSM[T], error) {
+	var root yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, &LoadError{Err: err}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, &LoadError{Line: root.Line, Column: root.Column, Err: errors.New("empty document")}
+	}
+
+	l := &loader[T]{registry: registry}
+	doc := l.document(root.Content[0])
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+
+	fsm := l.build(doc, opts)
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+
+	fsm.logger.info(context.Background(), "FSM loaded",
+		slog.String("initialState", string(doc.initial.value)),
+		slog.Int("states", len(doc.states)),
+		slog.Int("transitions", len(doc.transitions)))
+
+	return fsm, nil
+}
+
+// scalar is a string value together with the node it was read from.
+type scalar struct {
+	value string
+	node  *yaml.Node
+}
+
+type stateDoc struct {
+	node         *yaml.Node
+	name         scalar
+	parent       scalar
+	parallel     bool
+	final        bool
+	history      scalar
+	timeout      scalar
+	timeoutEvent scalar
+	onEnter      []scalar
+	onExit       []scalar
+}
+
+type transitionDoc struct {
+	node    *yaml.Node
+	from    scalar
+	to      scalar
+	event   scalar
+	guard   scalar
+	actions []scalar
+}
+
+type machineDoc struct {
+	node         *yaml.Node
+	version      scalar
+	initial      scalar
+	errorState   scalar
+	errorHandler scalar
+	states       []stateDoc
+	transitions  []transitionDoc
+}
+
+// loader collects the errors found while reading and building a definition.
+type loader[T any] struct {
+	registry *Registry[T]
+	errs     []error
+}
+
+func (l *loader[T]) fail(node *yaml.Node, err error) {
+	l.errs = append(l.errs, &LoadError{Line: node.Line, Column: node.Column, Err: err})
+}
+
+// mapping walks the key/value pairs of a mapping node.
+func (l *loader[T]) mapping(node *yaml.Node, fn func(key string, keyNode, value *yaml.Node)) {
+	if node.Kind != yaml.MappingNode {
+		l.fail(node, errors.New("expected a mapping"))
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, node.Content[i], node.Content[i+1])
+	}
+}
+
+func (l *loader[T]) scalar(node *yaml.Node) scalar {
+	if node.Kind != yaml.ScalarNode {
+		l.fail(node, errors.New("expected a scalar value"))
+	}
+	return scalar{value: node.Value, node: node}
+}
+
+func (l *loader[T]) scalars(node *yaml.Node) []scalar {
+	if node.Kind != yaml.SequenceNode {
+		l.fail(node, errors.New("expected a list"))
+		return nil
+	}
+	values := make([]scalar, 0, len(node.Content))
+	for _, item := range node.Content {
+		values = append(values, l.scalar(item))
+	}
+	return values
+}
+
+func (l *loader[T]) sequence(node *yaml.Node, fn func(item *yaml.Node)) {
+	if node.Kind != yaml.SequenceNode {
+		l.fail(node, errors.New("expected a list"))
+		return
+	}
+	for _, item := range node.Content {
+		fn(item)
+	}
+}
+
+func (l *loader[T]) unknownField(keyNode *yaml.Node) {
+	l.fail(keyNode, fmt.Errorf("unknown field %q", keyNode.Value))
+}
+
+func (l *loader[T]) required(parent *yaml.Node, field string, value scalar) {
+	if value.value == "" {
+		l.fail(parent, fmt.Errorf("missing %q", field))
+	}
+}
+
+func (l *loader[T]) document(node *yaml.Node) machineDoc {
+	doc := machineDoc{node: node}
+	l.mapping(node, func(key string, keyNode, value *yaml.Node) {
+		switch key {
+		case "version":
+			doc.version = l.scalar(value)
+		case "initial":
+			doc.initial = l.scalar(value)
+		case "error_state":
+			doc.errorState = l.scalar(value)
+		case "error_handler":
+			doc.errorHandler = l.scalar(value)
+		case "states":
+			l.sequence(value, func(item *yaml.Node) {
+				doc.states = append(doc.states, l.state(item))
+			})
+		case "transitions":
+			l.sequence(value, func(item *yaml.Node) {
+				doc.transitions = append(doc.transitions, l.transition(item))
+			})
+		default:
+			l.unknownField(keyNode)
+		}
+	})
+	l.required(node, "initial", doc.initial)
+	return doc
+}
+
+func (l *loader[T]) state(node *yaml.Node) stateDoc {
+	st := stateDoc{node: node}
+	l.mapping(node, func(key string, keyNode, value *yaml.Node) {
+		switch key {
+		case "name":
+			st.name = l.scalar(value)
+		case "parent":
+			st.parent = l.scalar(value)
+		case "parallel":
+			if err := value.Decode(&st.parallel); err != nil {
+				l.fail(value, errors.New("expected true or false"))
+			}
+		case "final":
+			if err := value.Decode(&st.final); err != nil {
+				l.fail(value, errors.New("expected true or false"))
+			}
+		case "history":
+			st.history = l.scalar(value)
+		case "timeout":
+			st.timeout = l.scalar(value)
+		case "timeout_event":
+			st.timeoutEvent = l.scalar(value)
+		case "on_enter":
+			st.onEnter = l.scalars(value)
+		case "on_exit":
+			st.onExit = l.scalars(value)
+		default:
+			l.unknownField(keyNode)
+		}
+	})
+	l.required(node, "name", st.name)
+	return st
+}
+
+func (l *loader[T]) transition(node *yaml.Node) transitionDoc {
+	tr := transitionDoc{node: node}
+	l.mapping(node, func(key string, keyNode, value *yaml.Node) {
+		switch key {
+		case "from":
+			tr.from = l.scalar(value)
+		case "to":
+			tr.to = l.scalar(value)
+		case "event":
+			tr.event = l.scalar(value)
+		case "guard":
+			tr.guard = l.scalar(value)
+		case "actions":
+			tr.actions = l.scalars(value)
+		default:
+			l.unknownField(keyNode)
+		}
+	})
+	l.required(node, "from", tr.from)
+	l.required(node, "to", tr.to)
+	l.required(node, "event", tr.event)
+	return tr
+}
+
+// stateOptions converts the optional settings of a state document into state options.
+func (l *loader[T]) stateOptions(st stateDoc) []StateOptionFunc {
+	var opts []StateOptionFunc
+	if st.parent.value != "" {
+		opts = append(opts, WithParent(State(st.parent.value)))
+	}
+	if st.parallel {
+		opts = append(opts, Parallel())
+	}
+	if st.final {
+		opts = append(opts, Final())
+	}
+	switch st.history.value {
+	case "":
+	case "shallow":
+		opts = append(opts, WithHistory(HistoryShallow))
+	case "deep":
+		opts = append(opts, WithHistory(HistoryDeep))
+	default:
+		l.fail(st.history.node, fmt.Errorf("unknown history %q, expected shallow or deep", st.history.value))
+	}
+	if st.timeout.value != "" || st.timeoutEvent.value != "" {
+		d, err := time.ParseDuration(st.timeout.value)
+		switch {
+		case st.timeout.value == "":
+			l.fail(st.node, errors.New("timeout_event needs a timeout"))
+		case err != nil:
+			l.fail(st.timeout.node, fmt.Errorf("invalid timeout: %v", err))
+		case st.timeoutEvent.value == "":
+			l.fail(st.timeout.node, errors.New("timeout needs a timeout_event"))
+		default:
+			opts = append(opts, WithTimeout(d, Event(st.timeoutEvent.value)))
+		}
+	}
+	return opts
+}
+
+func (l *loader[T]) actions(names []scalar) []Action[T] {
+	actions := make([]Action[T], 0, len(names))
+	for _, name := range names {
+		action, ok := l.registry.lookupAction(name.value)
+		if !ok {
+			l.fail(name.node, &ActionError{ActionName: name.value, Err: ErrUnknownAction})
+			continue
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// build creates the FSM described by a document.
+func (l *loader[T]) build(doc machineDoc, opts []FSMOptionFunc) *FSM[T] {
+	if doc.version.value != "" {
+		opts = append([]FSMOptionFunc{WithVersion(doc.version.value)}, opts...)
+	}
+	fsm := newFSM[T](State(doc.initial.value), opts)
+
+	for _, st := range doc.states {
+		options := l.stateOptions(st)
+		if err := fsm.RegisterState(State(st.name.value), options...); err != nil {
+			node := st.name.node
+			if errors.Is(err, ErrStateNotRegistered) && st.parent.node != nil {
+				node = st.parent.node
+			}
+			l.fail(node, err)
+		}
+	}
+
+	exists := func(s scalar) bool {
+		if fsm.states.Exists(State(s.value)) {
+			return true
+		}
+		l.fail(s.node, &StateError{Op: "Load", State: State(s.value), Err: ErrStateNotRegistered})
+		return false
+	}
+
+	if exists(doc.initial) {
+		fsm.resetInitial()
+	}
+
+	for _, st := range doc.states {
+		if !fsm.states.Exists(State(st.name.value)) {
+			continue
+		}
+		if len(st.onEnter) > 0 {
+			if err := fsm.OnEnter(State(st.name.value), l.actions(st.onEnter)...); err != nil {
+				l.fail(st.name.node, err)
+			}
+		}
+		if len(st.onExit) > 0 {
+			if err := fsm.OnExit(State(st.name.value), l.actions(st.onExit)...); err != nil {
+				l.fail(st.name.node, err)
+			}
+		}
+	}
+
+	if doc.errorState.value != "" || doc.errorHandler.value != "" {
+		var handler ActionFunc[T]
+		if doc.errorHandler.value != "" {
+			if action := l.actions([]scalar{doc.errorHandler}); len(action) == 1 {
+				handler = action[0].Fn
+			}
+		}
+		if doc.errorState.value == "" || exists(doc.errorState) {
+			fsm.SetErrorHandler(State(doc.errorState.value), handler)
+		}
+	}
+
+	type key struct {
+		from  State
+		event Event
+		guard string
+	}
+	seen := make(map[key]struct{})
+	for _, tr := range doc.transitions {
+		fromOK := exists(tr.from)
+		toOK := exists(tr.to)
+
+		var opts []TransitionOptionFunc[T]
+		if tr.guard.value != "" {
+			if guard, ok := l.registry.lookupGuard(tr.guard.value); ok {
+				opts = append(opts, WithGuard(tr.guard.value, guard))
+			} else {
+				l.fail(tr.guard.node, &ActionError{ActionName: tr.guard.value, Err: ErrUnknownGuard})
+			}
+		}
+		actions := l.actions(tr.actions)
+
+		k := key{from: State(tr.from.value), event: Event(tr.event.value), guard: tr.guard.value}
+		if _, dup := seen[k]; dup {
+			l.fail(tr.node, &TransitionError{
+				Message: "duplicate transition",
+				State:   k.from,
+				Event:   k.event,
+				Err:     ErrTransitionAlreadyExists,
+			})
+			continue
+		}
+		seen[k] = struct{}{}
+
+		if fromOK && toOK {
+			if err := fsm.addTransition(k.from, State(tr.to.value), k.event, actions, opts...); err != nil {
+				l.fail(tr.node, err)
+			}
+		}
+	}
+	return fsm
+}
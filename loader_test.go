@@ -0,0 +1,182 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const orderDefinition = `
+version: orders-v1
+initial: cart
+error_state: failed
+states:
+  - name: cart
+  - name: awaiting_payment
+    timeout: 15m
+    timeout_event: payment_timeout
+    on_enter: [mark]
+  - name: fulfilment
+  - name: picking
+    parent: fulfilment
+  - name: failed
+transitions:
+  - from: cart
+    to: awaiting_payment
+    event: checkout
+    guard: not_empty
+  - from: awaiting_payment
+    to: fulfilment
+    event: pay
+    actions: [mark]
+  - from: awaiting_payment
+    to: failed
+    event: payment_timeout
+`
+
+func newTestRegistry(t *testing.T) *Registry[TestData] {
+	t.Helper()
+	registry := NewRegistry[TestData]()
+	assert.NoError(t, registry.RegisterAction("mark", func(ctx context.Context, args *TestData) (*TestData, error) {
+		args.Counter++
+		return args, nil
+	}))
+	assert.NoError(t, registry.RegisterGuard("not_empty", func(ctx context.Context, args *TestData) bool {
+		return args.Value != ""
+	}))
+	return registry
+}
+
+func TestLoad_YAML(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm, err := Load(strings.NewReader(orderDefinition), newTestRegistry(t), WithClock(clock))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders-v1", fsm.Version)
+	assert.Equal(t, State("cart"), fsm.GetState())
+
+	ctx := context.Background()
+	_, err = fsm.Trigger(ctx, Event("checkout"), &TestData{})
+	assert.ErrorIs(t, err, ErrGuardRejected)
+
+	data := &TestData{Value: "book"}
+	_, err = fsm.Trigger(ctx, Event("checkout"), data)
+	assert.NoError(t, err)
+	_, err = fsm.Trigger(ctx, Event("pay"), data)
+	assert.NoError(t, err)
+	assert.Equal(t, State("picking"), fsm.GetState())
+	assert.Equal(t, 2, data.Counter)
+}
+
+func TestLoad_JSON(t *testing.T) {
+	doc := `{
+  "initial": "off",
+  "states": [{"name": "off"}, {"name": "on"}],
+  "transitions": [{"from": "off", "to": "on", "event": "toggle", "actions": ["mark"]}]
+}`
+	fsm, err := Load(strings.NewReader(doc), newTestRegistry(t))
+	assert.NoError(t, err)
+
+	data := &TestData{}
+	_, err = fsm.Trigger(context.Background(), Event("toggle"), data)
+	assert.NoError(t, err)
+	assert.Equal(t, State("on"), fsm.GetState())
+	assert.Equal(t, 1, data.Counter)
+}
+
+func TestLoad_InitialTimeout(t *testing.T) {
+	doc := `initial: wait
+states:
+  - name: wait
+    timeout: 1s
+    timeout_event: expire
+  - name: expired
+transitions:
+  - from: wait
+    to: expired
+    event: expire
+`
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm, err := Load(strings.NewReader(doc), newTestRegistry(t), WithClock(clock))
+	assert.NoError(t, err)
+	assert.Equal(t, State("wait"), fsm.GetState())
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, State("expired"), fsm.GetState())
+}
+
+func TestLoad_NilRegistry(t *testing.T) {
+	fsm, err := Load[TestData](strings.NewReader(orderDefinition), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "mark", fsm.transitions[1].Action[0].Name)
+	assert.Nil(t, fsm.transitions[1].Action[0].Fn)
+	assert.Equal(t, "not_empty", fsm.transitions[0].Guard.Name)
+	assert.Equal(t, []Action[TestData]{{Name: "mark"}}, fsm.entryActions[State("awaiting_payment")])
+}
+
+func TestLoad_FinalState(t *testing.T) {
+	doc := `initial: cart
+states:
+  - name: cart
+  - name: paid
+transitions:
+  - from: cart
+    to: paid
+    event: pay
+`
+	fsm, err := Load(strings.NewReader(doc), newTestRegistry(t))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, fsm.Validate(), ErrDeadEndState)
+
+	doc = strings.Replace(doc, "  - name: paid\n", "  - name: paid\n    final: true\n", 1)
+	fsm, err = Load(strings.NewReader(doc), newTestRegistry(t))
+	assert.NoError(t, err)
+	assert.True(t, fsm.states.IsFinal(State("paid")))
+	assert.NoError(t, fsm.Validate())
+}
+
+func TestLoad_ReportsErrorsWithLines(t *testing.T) {
+	doc := `initial: cart
+states:
+  - name: cart
+  - name: cart
+transitions:
+  - from: cart
+    to: nowhere
+    event: go
+    actions: [launch]
+  - from: cart
+    to: cart
+    event: stay
+    colour: blue
+`
+	_, err := Load(strings.NewReader(doc), newTestRegistry(t))
+	assert.Error(t, err)
+
+	var lines []int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var loadErr *LoadError
+		if assert.True(t, errors.As(e, &loadErr)) {
+			lines = append(lines, loadErr.Line)
+		}
+	}
+	assert.Equal(t, []int{13}, lines)
+
+	doc = strings.Replace(doc, "    colour: blue\n", "", 1)
+	_, err = Load(strings.NewReader(doc), newTestRegistry(t))
+	assert.ErrorIs(t, err, ErrStateAlreadyExists)
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+	assert.ErrorIs(t, err, ErrUnknownAction)
+
+	lines = nil
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var loadErr *LoadError
+		if assert.True(t, errors.As(e, &loadErr)) {
+			lines = append(lines, loadErr.Line)
+		}
+	}
+	assert.Equal(t, []int{4, 7, 9}, lines)
+}
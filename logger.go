@@ -0,0 +1,381 @@
+package nexus
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger is what the FSM writes its records through. Levels and attributes are those of
+// log/slog; NewSlogLogger and NewZerologLogger adapt the two libraries, and any other can be
+// plugged in by implementing the three methods.
+type Logger interface {
+	// Enabled reports whether records at level would be written.
+	Enabled(ctx context.Context, level slog.Level) bool
+	// Log writes a record with the given attributes.
+	Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+	// With returns a Logger that adds attrs to every record.
+	With(attrs ...slog.Attr) Logger
+}
+
+// LevelOff is a level above every other: an FSM logging at LevelOff writes no records.
+const LevelOff = slog.Level(math.MaxInt32)
+
+// WithLogger makes the FSM write its records to l. WithLogOutput and WithLogConsole are
+// ignored when a logger is set.
+func WithLogger(l Logger) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Logger = l
+	}
+}
+
+// WithSlogHandler makes the FSM write its records to a log/slog handler.
+func WithSlogHandler(h slog.Handler) FSMOptionFunc {
+	return WithLogger(NewSlogLogger(h))
+}
+
+// WithLogFields adds attrs to every record the FSM writes, such as a correlation ID. Passed
+// to Definition.NewInstance, they are added to the records of that instance only.
+func WithLogFields(attrs ...slog.Attr) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.LogFields = append(opts.LogFields[:len(opts.LogFields):len(opts.LogFields)], attrs...)
+	}
+}
+
+// slogLogger adapts a slog.Handler to Logger.
+type slogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger returns a Logger writing to a log/slog handler.
+func NewSlogLogger(h slog.Handler) Logger {
+	return slogLogger{handler: h}
+}
+
+func (l slogLogger) Enabled(ctx context.Context, level slog.Level) bool {
+	return l.handler.Enabled(ctx, level)
+}
+
+func (l slogLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	r.AddAttrs(attrs...)
+	_ = l.handler.Handle(ctx, r)
+}
+
+func (l slogLogger) With(attrs ...slog.Attr) Logger {
+	if len(attrs) == 0 {
+		return l
+	}
+	return slogLogger{handler: l.handler.WithAttrs(attrs)}
+}
+
+// zerologLogger adapts a zerolog.Logger to Logger.
+type zerologLogger struct {
+	logger zerolog.Logger
+}
+
+// NewZerologLogger returns a Logger writing to a zerolog logger. Records below the level of l
+// are dropped.
+func NewZerologLogger(l zerolog.Logger) Logger {
+	return zerologLogger{logger: l}
+}
+
+func (l zerologLogger) Enabled(_ context.Context, level slog.Level) bool {
+	zl := zerologLevel(level)
+	return zl >= l.logger.GetLevel() && zl >= zerolog.GlobalLevel()
+}
+
+func (l zerologLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if !l.Enabled(ctx, level) {
+		return
+	}
+	ev := l.logger.WithLevel(zerologLevel(level))
+	for _, attr := range attrs {
+		ev = zerologEvent(ev, attr)
+	}
+	ev.Msg(msg)
+}
+
+func (l zerologLogger) With(attrs ...slog.Attr) Logger {
+	if len(attrs) == 0 {
+		return l
+	}
+	c := l.logger.With()
+	for _, attr := range attrs {
+		c = zerologContext(c, attr)
+	}
+	return zerologLogger{logger: c.Logger()}
+}
+
+// zerologLevel maps a slog level onto the nearest zerolog level.
+func zerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zerolog.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zerolog.WarnLevel
+	case level >= slog.LevelInfo:
+		return zerolog.InfoLevel
+	case level >= slog.LevelDebug:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
+
+// zerologEvent adds attr to a zerolog event.
+func zerologEvent(ev *zerolog.Event, attr slog.Attr) *zerolog.Event {
+	v := attr.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return ev.Str(attr.Key, v.String())
+	case slog.KindInt64:
+		return ev.Int64(attr.Key, v.Int64())
+	case slog.KindUint64:
+		return ev.Uint64(attr.Key, v.Uint64())
+	case slog.KindFloat64:
+		return ev.Float64(attr.Key, v.Float64())
+	case slog.KindBool:
+		return ev.Bool(attr.Key, v.Bool())
+	case slog.KindDuration:
+		return ev.Dur(attr.Key, v.Duration())
+	case slog.KindTime:
+		return ev.Time(attr.Key, v.Time())
+	case slog.KindGroup:
+		dict := zerolog.Dict()
+		for _, a := range v.Group() {
+			dict = zerologEvent(dict, a)
+		}
+		return ev.Dict(attr.Key, dict)
+	}
+	if err, ok := v.Any().(error); ok {
+		return ev.AnErr(attr.Key, err)
+	}
+	return ev.Interface(attr.Key, v.Any())
+}
+
+// zerologContext adds attr to the fields of a zerolog logger.
+func zerologContext(c zerolog.Context, attr slog.Attr) zerolog.Context {
+	v := attr.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return c.Str(attr.Key, v.String())
+	case slog.KindInt64:
+		return c.Int64(attr.Key, v.Int64())
+	case slog.KindUint64:
+		return c.Uint64(attr.Key, v.Uint64())
+	case slog.KindFloat64:
+		return c.Float64(attr.Key, v.Float64())
+	case slog.KindBool:
+		return c.Bool(attr.Key, v.Bool())
+	case slog.KindDuration:
+		return c.Dur(attr.Key, v.Duration())
+	case slog.KindTime:
+		return c.Time(attr.Key, v.Time())
+	case slog.KindGroup:
+		dict := zerolog.Dict()
+		for _, a := range v.Group() {
+			dict = zerologEvent(dict, a)
+		}
+		return c.Dict(attr.Key, dict)
+	}
+	if err, ok := v.Any().(error); ok {
+		return c.AnErr(attr.Key, err)
+	}
+	return c.Interface(attr.Key, v.Any())
+}
+
+// baseLogger returns the Logger set in opts, or the default one, with the fields every record
+// of the FSM carries.
+func baseLogger(opts FSMOptions) Logger {
+	logger := opts.Logger
+	if logger == nil {
+		logger = defaultLogger(opts.UseStdOut, opts.LogOutput)
+	}
+	if opts.LogSampling.First > 0 || opts.LogSampling.Thereafter > 0 {
+		logger = newSamplingLogger(logger, opts.LogSampling, opts.Clock)
+	}
+	return logger.With(append([]slog.Attr{slog.String("component", "fsm")}, opts.LogFields...)...)
+}
+
+// defaultLogger returns the Logger the FSM writes to when none is set: a zerolog logger
+// writing to logOutput, or to stdout for console output, and a no-op logger otherwise.
+func defaultLogger(useStdOut bool, logOutput io.Writer) Logger {
+	if logOutput == nil && !useStdOut {
+		return nopLogger{}
+	}
+	if logOutput == nil {
+		logOutput = os.Stdout
+	}
+	if useStdOut {
+		logOutput = zerolog.ConsoleWriter{Out: logOutput}
+	}
+	return NewZerologLogger(zerolog.New(logOutput).With().Timestamp().Logger())
+}
+
+// nopLogger is a Logger that writes nothing.
+type nopLogger struct{}
+
+func (nopLogger) Enabled(context.Context, slog.Level) bool              { return false }
+func (nopLogger) Log(context.Context, slog.Level, string, ...slog.Attr) {}
+func (l nopLogger) With(...slog.Attr) Logger                            { return l }
+
+// fsmLogger is the Logger of a definition or instance together with the level it logs at,
+// which SetLogLevel changes at runtime.
+type fsmLogger struct {
+	Logger
+	level *slog.LevelVar
+}
+
+// newFSMLogger returns an fsmLogger writing records at level or above to l.
+func newFSMLogger(l Logger, level slog.Level) fsmLogger {
+	lv := new(slog.LevelVar)
+	lv.Set(level)
+	return fsmLogger{Logger: l, level: lv}
+}
+
+// enabled reports whether both the FSM and the Logger are enabled for level. Call sites guard
+// with it when working out the attributes of a record costs more than the attributes do.
+func (l fsmLogger) enabled(ctx context.Context, level slog.Level) bool {
+	return level >= l.level.Level() && l.Enabled(ctx, level)
+}
+
+// log writes a record if level is enabled. attrs are copied before being handed to the
+// Logger, so that they do not escape and a disabled record does not allocate.
+func (l fsmLogger) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if !l.enabled(ctx, level) {
+		return
+	}
+	l.Log(ctx, level, msg, slices.Clone(attrs)...)
+}
+
+func (l fsmLogger) debug(ctx context.Context, msg string, attrs ...slog.Attr) {
+	l.log(ctx, slog.LevelDebug, msg, attrs...)
+}
+
+func (l fsmLogger) info(ctx context.Context, msg string, attrs ...slog.Attr) {
+	l.log(ctx, slog.LevelInfo, msg, attrs...)
+}
+
+func (l fsmLogger) warn(ctx context.Context, msg string, attrs ...slog.Attr) {
+	l.log(ctx, slog.LevelWarn, msg, attrs...)
+}
+
+func (l fsmLogger) error(ctx context.Context, msg string, attrs ...slog.Attr) {
+	l.log(ctx, slog.LevelError, msg, attrs...)
+}
+
+// errAttr returns the attribute a record carries its error under.
+func errAttr(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// LogSampling thins out records that repeat in quick succession. Records at LevelError and
+// above are always written.
+type LogSampling struct {
+	// First is how many records with the same level and message are written each Period.
+	First int
+	// Thereafter writes every Thereafter-th record past the first ones; 0 drops them all.
+	Thereafter int
+	// Period is how long the counts last before starting over; 0 never starts them over.
+	Period time.Duration
+}
+
+// WithLogSampling writes the first records with the same level and message each period, then
+// only every thereafter-th, so that a busy machine does not flood the log. A period of 0 never
+// starts the counts over. The counts are shared by every instance of a definition.
+func WithLogSampling(first, thereafter int, period time.Duration) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.LogSampling = LogSampling{First: first, Thereafter: thereafter, Period: period}
+	}
+}
+
+// samplingLogger is a Logger writing a sample of the records it is given.
+type samplingLogger struct {
+	Logger
+	sampler *sampler
+}
+
+// newSamplingLogger returns a Logger writing a sample of the records to l.
+func newSamplingLogger(l Logger, s LogSampling, clock Clock) Logger {
+	return samplingLogger{Logger: l, sampler: &sampler{LogSampling: s, clock: clock, counts: make(map[sampleKey]*sampleCount)}}
+}
+
+func (l samplingLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if level < slog.LevelError && !l.sampler.sample(level, msg) {
+		return
+	}
+	l.Logger.Log(ctx, level, msg, attrs...)
+}
+
+func (l samplingLogger) With(attrs ...slog.Attr) Logger {
+	return samplingLogger{Logger: l.Logger.With(attrs...), sampler: l.sampler}
+}
+
+// sampler counts records by level and message.
+type sampler struct {
+	LogSampling
+	clock  Clock
+	mu     sync.RWMutex
+	counts map[sampleKey]*sampleCount
+}
+
+type sampleKey struct {
+	level slog.Level
+	msg   string
+}
+
+// sampleCount is the number of records seen since the period started.
+type sampleCount struct {
+	n       atomic.Int64
+	resetAt atomic.Int64
+}
+
+// sample counts a record and reports whether it should be written.
+func (s *sampler) sample(level slog.Level, msg string) bool {
+	key := sampleKey{level: level, msg: msg}
+	s.mu.RLock()
+	c, ok := s.counts[key]
+	s.mu.RUnlock()
+	if !ok {
+		s.mu.Lock()
+		if c, ok = s.counts[key]; !ok {
+			c = &sampleCount{}
+			s.counts[key] = c
+		}
+		s.mu.Unlock()
+	}
+
+	var n int64
+	if s.Period > 0 {
+		n = c.inc(s.clock.Now().UnixNano(), s.Period.Nanoseconds())
+	} else {
+		n = c.n.Add(1)
+	}
+	if n <= int64(s.First) {
+		return true
+	}
+	return s.Thereafter > 0 && (n-int64(s.First))%int64(s.Thereafter) == 0
+}
+
+// inc adds a record at now to the count, starting the count over if the period has passed,
+// and returns the new count.
+func (c *sampleCount) inc(now, period int64) int64 {
+	resetAt := c.resetAt.Load()
+	if now < resetAt {
+		return c.n.Add(1)
+	}
+	if !c.resetAt.CompareAndSwap(resetAt, now+period) {
+		return c.n.Add(1)
+	}
+	c.n.Store(1)
+	return 1
+}
@@ -0,0 +1,241 @@
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeLogs parses JSON lines into one map per record.
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWithSlogHandler_InstanceFields(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	def := newOrderDefinition(t, WithSlogHandler(handler), WithLogLevel(slog.LevelDebug),
+		WithLogFields(slog.String("service", "orders")))
+
+	fsm, err := def.NewInstance("order-1", WithLogFields(slog.String("correlation_id", "req-42")))
+	assert.NoError(t, err)
+	other, err := def.NewInstance("order-2")
+	assert.NoError(t, err)
+
+	buf.Reset()
+	_, err = fsm.Trigger(context.Background(), Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+
+	records := decodeLogs(t, &buf)
+	assert.NotEmpty(t, records)
+	for _, record := range records {
+		assert.Equal(t, "fsm", record["component"])
+		assert.Equal(t, "orders", record["service"])
+		assert.Equal(t, "order-1", record["instance"])
+		assert.Equal(t, "req-42", record["correlation_id"])
+	}
+
+	buf.Reset()
+	_, err = other.Trigger(context.Background(), Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+	for _, record := range decodeLogs(t, &buf) {
+		assert.Equal(t, "order-2", record["instance"])
+		assert.NotContains(t, record, "correlation_id")
+	}
+}
+
+func TestFSM_SetLogLevel_CustomLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	fsm := New[TestData](State("idle"), WithSlogHandler(handler))
+	assert.NoError(t, fsm.RegisterState(State("running")))
+	fsm.AddTransition(State("idle"), State("running"), Event("start"), nil)
+	fsm.AddTransition(State("running"), State("idle"), Event("stop"), nil)
+
+	buf.Reset()
+	_, err := fsm.Trigger(context.Background(), Event("start"), &TestData{})
+	assert.NoError(t, err)
+	for _, record := range decodeLogs(t, &buf) {
+		assert.NotEqual(t, "DEBUG", record["level"])
+	}
+
+	fsm.SetLogLevel(slog.LevelDebug)
+	buf.Reset()
+	_, err = fsm.Trigger(context.Background(), Event("stop"), &TestData{})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"msg":"Trigger called"`)
+
+	buf.Reset()
+	assert.NoError(t, fsm.RegisterState(State("done")))
+	fsm.AddTransition(State("running"), State("done"), Event("finish"), nil)
+	assert.Contains(t, buf.String(), `"msg":"State registered"`)
+	assert.Contains(t, buf.String(), `"msg":"Transition registered"`)
+
+	fsm.SetLogLevel(LevelOff)
+	buf.Reset()
+	_, err = fsm.Trigger(context.Background(), Event("missing"), &TestData{})
+	assert.ErrorIs(t, err, ErrNoTransition)
+	assert.Empty(t, buf.String())
+}
+
+func TestFSM_NoLogsByDefault(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	assert.IsType(t, nopLogger{}, fsm.logger.Logger)
+	assert.False(t, fsm.logger.enabled(context.Background(), slog.LevelError))
+
+	fsm = New[TestData](State("idle"), WithLogOutput(io.Discard))
+	assert.IsType(t, zerologLogger{}, fsm.logger.Logger)
+	fsm = New[TestData](State("idle"), WithLogConsole())
+	assert.IsType(t, zerologLogger{}, fsm.logger.Logger)
+}
+
+func TestFSM_DisabledLogsDoNotAllocate(t *testing.T) {
+	handler := slog.NewJSONHandler(io.Discard, nil)
+	for name, fsm := range map[string]*FSM[TestData]{
+		"default":  New[TestData](State("idle")),
+		"disabled": New[TestData](State("idle"), WithSlogHandler(handler), WithLogLevel(slog.LevelWarn)),
+	} {
+		ctx, err := context.Background(), errors.New("boom")
+		allocs := testing.AllocsPerRun(100, func() {
+			fsm.logger.info(ctx, "Action failed", errAttr(err), slog.String("state", "idle"), slog.Int("attempt", 2))
+		})
+		assert.Zero(t, allocs, name)
+	}
+}
+
+func TestWithLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("off"), WithClock(clock), WithLogSampling(2, 3, time.Second),
+		WithSlogHandler(slog.NewJSONHandler(&buf, nil)))
+	assert.NoError(t, fsm.RegisterState(State("on")))
+	fsm.AddTransition(State("off"), State("on"), Event("toggle"), nil)
+	fsm.AddTransition(State("on"), State("off"), Event("toggle"), nil)
+	fsm.AddTransition(State("off"), State("off"), Event("fail"), []Action[TestData]{{
+		Name: "fail",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			return args, errors.New("boom")
+		},
+	}})
+
+	count := func(msg string) int {
+		return strings.Count(buf.String(), `"msg":"`+msg+`"`)
+	}
+	toggle := func(n int) {
+		for i := 0; i < n; i++ {
+			_, err := fsm.Trigger(context.Background(), Event("toggle"), &TestData{})
+			assert.NoError(t, err)
+		}
+	}
+
+	toggle(10)
+	assert.Equal(t, 4, count("Transitioning")) // the 1st, 2nd, 5th and 8th
+
+	clock.Advance(time.Second)
+	toggle(2)
+	assert.Equal(t, 6, count("Transitioning"))
+
+	for i := 0; i < 5; i++ {
+		_, err := fsm.Trigger(context.Background(), Event("fail"), &TestData{})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 5, count("Action failed"))
+}
+
+func TestWithLogSampling_NoPeriod(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewFakeClock(time.Unix(0, 0))
+	logger := newSamplingLogger(NewSlogLogger(slog.NewJSONHandler(&buf, nil)), LogSampling{First: 1}, clock)
+
+	for i := 0; i < 10; i++ {
+		logger.Log(context.Background(), slog.LevelInfo, "Transitioning")
+		clock.Advance(time.Hour)
+	}
+	assert.Equal(t, 1, strings.Count(buf.String(), `"msg":"Transitioning"`))
+}
+
+func TestZerologLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewZerologLogger(zerolog.New(&buf).Level(zerolog.InfoLevel)).
+		With(slog.String("instance", "order-1"))
+
+	assert.False(t, logger.Enabled(context.Background(), slog.LevelDebug))
+	assert.True(t, logger.Enabled(context.Background(), slog.LevelWarn))
+
+	logger.Log(context.Background(), slog.LevelDebug, "dropped")
+	logger.Log(context.Background(), slog.LevelWarn, "Action failed",
+		errAttr(errors.New("card declined")),
+		slog.Int("attempt", 2),
+		slog.Duration("timeout", time.Second),
+		slog.Group("order", slog.String("id", "o-7"), slog.Bool("paid", false)),
+		slog.Any("actions", []string{"charge", "email"}))
+
+	records := decodeLogs(t, &buf)
+	assert.Len(t, records, 1)
+	assert.Equal(t, map[string]any{
+		"level":    "warn",
+		"message":  "Action failed",
+		"instance": "order-1",
+		"error":    "card declined",
+		"attempt":  float64(2),
+		"timeout":  float64(1000),
+		"order":    map[string]any{"id": "o-7", "paid": false},
+		"actions":  []any{"charge", "email"},
+	}, records[0])
+}
+
+func BenchmarkFSM_Trigger_Logging(b *testing.B) {
+	discard := slog.NewJSONHandler(io.Discard, nil)
+	cases := []struct {
+		name string
+		opts []FSMOptionFunc
+	}{
+		{"default", nil},
+		{"output", []FSMOptionFunc{WithLogOutput(io.Discard)}}, // what New used to do by default, to stdout
+		{"disabled", []FSMOptionFunc{WithSlogHandler(discard), WithLogLevel(slog.LevelWarn)}},
+		{"slog", []FSMOptionFunc{WithSlogHandler(discard)}},
+		{"zerolog", []FSMOptionFunc{WithLogger(NewZerologLogger(zerolog.New(io.Discard)))}},
+		{"sampled", []FSMOptionFunc{WithSlogHandler(discard), WithLogSampling(10, 100, time.Second)}},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			fsm := New[TestData](State("off"), c.opts...)
+			if err := fsm.RegisterState(State("on")); err != nil {
+				b.Fatal(err)
+			}
+			count := []Action[TestData]{{Name: "count", Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+				args.Counter++
+				return args, nil
+			}}}
+			fsm.AddTransition(State("off"), State("on"), Event("toggle"), count)
+			fsm.AddTransition(State("on"), State("off"), Event("toggle"), count)
+			ctx, data := context.Background(), &TestData{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := fsm.Trigger(ctx, Event("toggle"), data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ManagerOptions holds configuration options for a Manager.
+type ManagerOptions struct {
+	// Store keeps the state of every instance. Without a store instances only live in memory.
+	Store Store
+	// IdleTimeout evicts instances that have not been used for this long. 0 disables idle
+	// eviction. It requires a Store.
+	IdleTimeout time.Duration
+	// InstanceOptions are passed to Definition.NewInstance for every instance.
+	InstanceOptions []FSMOptionFunc
+}
+
+type ManagerOptionFunc func(*ManagerOptions)
+
+// WithStore keeps the state of every instance in store, so that instances can be evicted
+// from memory and loaded again on demand.
+func WithStore(store Store) ManagerOptionFunc {
+	return func(opts *ManagerOptions) {
+		opts.Store = store
+	}
+}
+
+// WithIdleTimeout evicts instances that have not been used for d. Idle eviction needs a
+// store and is ignored without one.
+func WithIdleTimeout(d time.Duration) ManagerOptionFunc {
+	return func(opts *ManagerOptions) {
+		opts.IdleTimeout = d
+	}
+}
+
+// WithInstanceOptions sets the options every instance is created with.
+func WithInstanceOptions(opts ...FSMOptionFunc) ManagerOptionFunc {
+	return func(o *ManagerOptions) {
+		o.InstanceOptions = append(o.InstanceOptions, opts...)
+	}
+}
+
+// Manager creates, looks up, triggers and evicts instances of a definition by ID.
+//
+// The manager only locks its index briefly; every instance has its own lock, so different
+// instances can be triggered concurrently. With a store, instances are bound to their record
+// (see FSM.Bind): an evicted instance keeps its state in the store and is loaded again the
+// next time it is used.
+type Manager[T any] struct {
+	ManagerOptions
+	def     *Definition[T]
+	clock   Clock
+	mu      sync.RWMutex
+	entries map[string]*managed[T]
+}
+
+// managed is an instance held by a Manager.
+type managed[T any] struct {
+	// mu is held for reading while the instance is in use and for writing while it is loaded
+	// or evicted.
+	mu       sync.RWMutex
+	fsm      *FSM[T]
+	evicted  bool
+	lastUsed atomic.Int64
+	timer    Timer
+}
+
+// NewManager creates a manager of instances of def.
+func NewManager[T any](def *Definition[T], options ...ManagerOptionFunc) *Manager[T] {
+	var opts ManagerOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	// Idle time is measured with the clock the instances use.
+	instanceOpts := def.FSMOptions
+	for _, opt := range opts.InstanceOptions {
+		opt(&instanceOpts)
+	}
+
+	return &Manager[T]{
+		ManagerOptions: opts,
+		def:            def,
+		clock:          instanceOpts.Clock,
+		entries:        make(map[string]*managed[T]),
+	}
+}
+
+// Create creates a new instance in the initial state of the definition.
+// Returns an InstanceError wrapping ErrInstanceExists if an instance with that ID is in
+// memory or in the store.
+func (m *Manager[T]) Create(ctx context.Context, id string) (*FSM[T], error) {
+	m.mu.Lock()
+	if _, ok := m.entries[id]; ok {
+		m.mu.Unlock()
+		return nil, &InstanceError{Op: "Create", ID: id, Err: ErrInstanceExists}
+	}
+	e := m.reserve(id)
+	m.mu.Unlock()
+
+	fsm, err := m.open(ctx, "Create", id, true)
+	m.settle(id, e, fsm)
+	if err != nil {
+		return nil, err
+	}
+	return fsm, nil
+}
+
+// Get returns the instance with the given ID, loading it from the store if it was evicted.
+// Returns an InstanceError wrapping ErrInstanceNotFound if there is no such instance.
+//
+// The instance may be evicted at any time after Get returns; use Do or Trigger to make sure
+// it stays in memory while it is used.
+func (m *Manager[T]) Get(ctx context.Context, id string) (*FSM[T], error) {
+	e, err := m.acquire(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+	return e.fsm, nil
+}
+
+// Do calls fn with the instance with the given ID, which is not evicted until fn returns.
+func (m *Manager[T]) Do(ctx context.Context, id string, fn func(*FSM[T]) error) error {
+	e, err := m.acquire(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer e.mu.RUnlock()
+	return fn(e.fsm)
+}
+
+// Trigger triggers an event on the instance with the given ID. See FSM.Trigger.
+func (m *Manager[T]) Trigger(ctx context.Context, id string, event Event, args *T) (*T, error) {
+	e, err := m.acquire(ctx, id)
+	if err != nil {
+		return args, err
+	}
+	defer e.mu.RUnlock()
+	return e.fsm.Trigger(ctx, event, args)
+}
+
+// Evict stops the instance with the given ID and drops it from memory. Its state stays in the
+// store and it is loaded again the next time it is used. Evicting an instance that is not in
+// memory does nothing.
+//
+// Returns an InstanceError wrapping ErrStoreRequired if the manager has no store.
+func (m *Manager[T]) Evict(id string) error {
+	if m.Store == nil {
+		return &InstanceError{Op: "Evict", ID: id, Err: ErrStoreRequired}
+	}
+	m.mu.RLock()
+	e, ok := m.entries[id]
+	m.mu.RUnlock()
+	if ok {
+		m.evict(id, e)
+	}
+	return nil
+}
+
+// Remove stops the instance with the given ID and deletes it from memory and from the store.
+// Returns an InstanceError wrapping ErrInstanceNotFound if there is no such instance.
+func (m *Manager[T]) Remove(ctx context.Context, id string) error {
+	m.mu.RLock()
+	e, inMemory := m.entries[id]
+	m.mu.RUnlock()
+	if inMemory {
+		m.evict(id, e)
+	}
+	if m.Store == nil {
+		if !inMemory {
+			return &InstanceError{Op: "Remove", ID: id, Err: ErrInstanceNotFound}
+		}
+		return nil
+	}
+
+	record, err := m.Store.Load(ctx, id)
+	if errors.Is(err, ErrRecordNotFound) {
+		return &InstanceError{Op: "Remove", ID: id, Err: ErrInstanceNotFound}
+	}
+	if err == nil {
+		err = m.Store.Delete(ctx, id, record.Version)
+	}
+	if err != nil {
+		return &StoreError{Op: "Remove", ID: id, Err: err}
+	}
+	return nil
+}
+
+// IDs returns the IDs of the instances in memory, sorted.
+func (m *Manager[T]) IDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.entries))
+	for id := range m.entries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Close stops every instance in memory and drops it. With a store their state stays there.
+func (m *Manager[T]) Close() {
+	m.mu.RLock()
+	entries := make(map[string]*managed[T], len(m.entries))
+	for id, e := range m.entries {
+		entries[id] = e
+	}
+	m.mu.RUnlock()
+
+	for id, e := range entries {
+		m.evict(id, e)
+	}
+}
+
+// acquire returns the entry of an instance, loading it if needed, with its lock held for
+// reading.
+func (m *Manager[T]) acquire(ctx context.Context, id string) (*managed[T], error) {
+	for {
+		m.mu.RLock()
+		e, ok := m.entries[id]
+		m.mu.RUnlock()
+
+		if !ok {
+			m.mu.Lock()
+			if e, ok = m.entries[id]; !ok {
+				e = m.reserve(id)
+				m.mu.Unlock()
+
+				fsm, err := m.open(ctx, "Get", id, false)
+				m.settle(id, e, fsm)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				m.mu.Unlock()
+			}
+		}
+
+		e.mu.RLock()
+		if e.evicted {
+			// Evicted, or failed to load, while we waited: look again.
+			e.mu.RUnlock()
+			continue
+		}
+		e.lastUsed.Store(m.clock.Now().UnixNano())
+		return e, nil
+	}
+}
+
+// reserve adds an entry for an instance that is being loaded, locked until settle is called.
+// NOTE: Should be called with the lock
+func (m *Manager[T]) reserve(id string) *managed[T] {
+	e := &managed[T]{}
+	e.mu.Lock()
+	m.entries[id] = e
+	return e
+}
+
+// settle finishes loading a reserved entry. A nil fsm means loading failed and drops the
+// entry.
+func (m *Manager[T]) settle(id string, e *managed[T], fsm *FSM[T]) {
+	defer e.mu.Unlock()
+
+	if fsm == nil {
+		e.evicted = true
+		m.mu.Lock()
+		delete(m.entries, id)
+		m.mu.Unlock()
+		return
+	}
+
+	e.fsm = fsm
+	e.lastUsed.Store(m.clock.Now().UnixNano())
+	if m.Store != nil && m.IdleTimeout > 0 {
+		e.timer = m.clock.AfterFunc(m.IdleTimeout, func() { m.checkIdle(id, e) })
+	}
+}
+
+// open creates an instance, bound to its record if the manager has a store. A new instance
+// must not have a record yet, an existing one must.
+func (m *Manager[T]) open(ctx context.Context, op, id string, create bool) (*FSM[T], error) {
+	if m.Store == nil && !create {
+		return nil, &InstanceError{Op: op, ID: id, Err: ErrInstanceNotFound}
+	}
+	if m.Store != nil {
+		_, err := m.Store.Load(ctx, id)
+		switch {
+		case err == nil && create:
+			return nil, &InstanceError{Op: op, ID: id, Err: ErrInstanceExists}
+		case errors.Is(err, ErrRecordNotFound) && !create:
+			return nil, &InstanceError{Op: op, ID: id, Err: ErrInstanceNotFound}
+		case err != nil && !errors.Is(err, ErrRecordNotFound):
+			return nil, &StoreError{Op: op, ID: id, Err: err}
+		}
+	}
+
+	fsm, err := m.def.NewInstance(id, m.InstanceOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if m.Store != nil {
+		if err := fsm.Bind(ctx, m.Store, id); err != nil {
+			fsm.passivate()
+			return nil, err
+		}
+	}
+	return fsm, nil
+}
+
+// checkIdle evicts an instance that has not been used for the idle timeout, or checks again
+// when it would be.
+func (m *Manager[T]) checkIdle(id string, e *managed[T]) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.evicted {
+		return
+	}
+
+	idle := m.clock.Now().Sub(time.Unix(0, e.lastUsed.Load()))
+	if idle >= m.IdleTimeout {
+		m.evictLocked(id, e)
+		return
+	}
+	e.timer = m.clock.AfterFunc(m.IdleTimeout-idle, func() { m.checkIdle(id, e) })
+}
+
+// evict stops an instance and drops it from memory, waiting for its current users.
+func (m *Manager[T]) evict(id string, e *managed[T]) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.evicted {
+		m.evictLocked(id, e)
+	}
+}
+
+// evictLocked stops an instance and drops it from memory.
+// NOTE: Should be called with the lock of the entry
+func (m *Manager[T]) evictLocked(id string, e *managed[T]) {
+	e.evicted = true
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	e.fsm.passivate()
+
+	m.mu.Lock()
+	if m.entries[id] == e {
+		delete(m.entries, id)
+	}
+	m.mu.Unlock()
+
+	e.fsm.logger.debug(context.Background(), "Instance evicted")
+}
+
+// passivate stops the run loop and every timeout of the FSM, leaving its state as it is.
+func (f *FSM[T]) passivate() {
+	_ = f.Stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopTimers()
+}
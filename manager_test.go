@@ -0,0 +1,144 @@
+package nexus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_InMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(newOrderDefinition(t))
+
+	fsm, err := m.Create(ctx, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", fsm.ID())
+
+	_, err = m.Create(ctx, "order-1")
+	assert.ErrorIs(t, err, ErrInstanceExists)
+
+	_, err = m.Trigger(ctx, "order-1", Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+	got, err := m.Get(ctx, "order-1")
+	assert.NoError(t, err)
+	assert.Same(t, fsm, got)
+	assert.Equal(t, State("awaiting_payment"), got.GetState())
+
+	_, err = m.Get(ctx, "order-2")
+	assert.ErrorIs(t, err, ErrInstanceNotFound)
+	assert.ErrorIs(t, m.Evict("order-1"), ErrStoreRequired)
+
+	assert.NoError(t, m.Remove(ctx, "order-1"))
+	assert.Empty(t, m.IDs())
+	assert.ErrorIs(t, m.Remove(ctx, "order-1"), ErrInstanceNotFound)
+}
+
+func TestManager_EvictAndReload(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	clock := NewFakeClock(time.Unix(0, 0))
+	m := NewManager(newOrderDefinition(t), WithStore(store), WithInstanceOptions(WithClock(clock)))
+
+	_, err := m.Create(ctx, "order-1")
+	assert.NoError(t, err)
+	_, err = m.Trigger(ctx, "order-1", Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.Evict("order-1"))
+	assert.Empty(t, m.IDs())
+
+	// The timeout of an evicted instance does not fire until it is loaded again.
+	clock.Advance(30 * time.Minute)
+	record, err := store.Load(ctx, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"awaiting_payment"}, record.Snapshot.Active)
+
+	fsm, err := m.Get(ctx, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, State("awaiting_payment"), fsm.GetState())
+	assert.Equal(t, []string{"order-1"}, m.IDs())
+
+	clock.Advance(30 * time.Minute)
+	assert.Equal(t, State("expired"), fsm.GetState())
+
+	_, err = m.Create(ctx, "order-1")
+	assert.ErrorIs(t, err, ErrInstanceExists)
+	assert.NoError(t, m.Evict("order-1"))
+	_, err = m.Create(ctx, "order-1")
+	assert.ErrorIs(t, err, ErrInstanceExists)
+
+	assert.NoError(t, m.Remove(ctx, "order-1"))
+	_, err = store.Load(ctx, "order-1")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+	_, err = m.Get(ctx, "order-1")
+	assert.ErrorIs(t, err, ErrInstanceNotFound)
+}
+
+func TestManager_IdleEviction(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Unix(0, 0))
+	m := NewManager(newOrderDefinition(t),
+		WithStore(NewMemoryStore()),
+		WithIdleTimeout(10*time.Minute),
+		WithInstanceOptions(WithClock(clock)))
+
+	_, err := m.Create(ctx, "order-1")
+	assert.NoError(t, err)
+	_, err = m.Create(ctx, "order-2")
+	assert.NoError(t, err)
+
+	clock.Advance(8 * time.Minute)
+	_, err = m.Trigger(ctx, "order-1", Event("checkout"), &TestData{})
+	assert.NoError(t, err)
+
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, []string{"order-1"}, m.IDs())
+
+	clock.Advance(8 * time.Minute)
+	assert.Empty(t, m.IDs())
+
+	_, err = m.Trigger(ctx, "order-1", Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	fsm, err := m.Get(ctx, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, State("paid"), fsm.GetState())
+}
+
+func TestManager_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(newOrderDefinition(t), WithStore(NewMemoryStore()))
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("order-%d", i)
+		_, err := m.Create(ctx, id)
+		assert.NoError(t, err)
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			data := &TestData{}
+			_, err := m.Trigger(ctx, id, Event("checkout"), data)
+			assert.NoError(t, err)
+			_, err = m.Trigger(ctx, id, Event("pay"), data)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.Evict(id))
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, m.Do(ctx, fmt.Sprintf("order-%d", i), func(fsm *FSM[TestData]) error {
+			assert.Equal(t, State("paid"), fsm.GetState())
+			return nil
+		}))
+	}
+}
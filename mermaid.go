@@ -0,0 +1,458 @@
+package nexus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// WriteMermaid writes the machine definition as a Mermaid stateDiagram-v2.
+//
+// Nested states become composite states, parallel regions are separated with "--", history
+// pseudo-states are drawn as "H" or "H*", and "[*]" marks the initial state and the final
+// states. Transitions are labelled "event [guard] / action, action" and listed after all the
+// states, in registration order.
+//
+// States whose names are not plain identifiers, such as names with spaces or punctuation, are
+// declared as state "name" as s1 and referred to by that alias. Returns an error wrapping
+// ErrUnsupportedConstruct for a name holding a double quote or a line break, and for a history
+// pseudo-state that would need an alias, since neither can be written.
+func (f *FSM[T]) WriteMermaid(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	ids, err := f.mermaidIDs()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	m := &lineWriter{w: bw}
+
+	m.line(0, "stateDiagram-v2")
+	m.line(1, "[*] --> %s", ids[f.initial])
+	f.writeMermaidScope(m, ids, "", 1)
+	for _, t := range f.transitions {
+		m.line(1, "%s --> %s : %s", mermaidRef(ids, t.From), mermaidRef(ids, t.To), transitionLabel(&t))
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+	return bw.Flush()
+}
+
+// mermaidIDs returns the identifier every state is written as: its name if that is a plain
+// identifier, or an alias otherwise.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) mermaidIDs() (map[State]string, error) {
+	ids := make(map[State]string)
+	next := 0
+	for _, state := range f.states.Keys() {
+		switch {
+		case mermaidID.MatchString(string(state)):
+			ids[state] = string(state)
+			continue
+		case strings.ContainsAny(string(state), "\"\r\n"):
+			return nil, &StateError{Op: "WriteMermaid", State: state, Err: ErrUnsupportedConstruct}
+		case f.states.IsHistory(state):
+			return nil, &StateError{Op: "WriteMermaid", State: state, Err: ErrUnsupportedConstruct}
+		}
+		for {
+			next++
+			if alias := fmt.Sprintf("s%d", next); !f.states.Exists(State(alias)) {
+				ids[state] = alias
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// mermaidRef returns the identifier a transition refers to state by, which is the state name
+// itself for states that are not registered.
+func mermaidRef(ids map[State]string, state State) string {
+	if id, ok := ids[state]; ok {
+		return id
+	}
+	return string(state)
+}
+
+// writeMermaidScope writes the substates of parent, or the top-level states if parent is empty.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) writeMermaidScope(m *lineWriter, ids map[State]string, parent State, depth int) {
+	var children []State
+	if parent == "" {
+		for _, state := range f.states.Keys() {
+			if f.states.Parent(state) == "" {
+				children = append(children, state)
+			}
+		}
+	} else {
+		children = f.states.Children(parent)
+		if !f.states.IsParallel(parent) && len(children) > 0 {
+			m.line(depth, "[*] --> %s", ids[children[0]])
+		}
+	}
+
+	for i, child := range children {
+		if i > 0 && f.states.IsParallel(parent) {
+			m.line(depth, "--")
+		}
+		id := ids[child]
+		if id != string(child) {
+			m.line(depth, "state \"%s\" as %s", child, id)
+		}
+		if len(f.states.Children(child)) > 0 || len(f.states.Histories(child)) > 0 {
+			m.line(depth, "state %s {", id)
+			f.writeMermaidScope(m, ids, child, depth+1)
+			m.line(depth, "}")
+		} else if id == string(child) {
+			m.line(depth, "%s", id)
+		}
+	}
+	if parent != "" {
+		for _, history := range f.states.Histories(parent) {
+			label := "H"
+			if f.states.HistoryKind(history) == HistoryDeep {
+				label = "H*"
+			}
+			m.line(depth, "state %q as %s", label, history)
+		}
+	}
+	for _, child := range children {
+		if f.states.IsFinal(child) {
+			m.line(depth, "%s --> [*]", ids[child])
+		}
+	}
+}
+
+var (
+	mermaidTransition = regexp.MustCompile(`^(\S+)\s*-->\s*(\S+)\s*(?::\s*(.*))?$`)
+	mermaidAlias      = regexp.MustCompile(`^state\s+"([^"]*)"\s+as\s+(\S+)$`)
+	mermaidComposite  = regexp.MustCompile(`^state\s+(\S+)\s*\{$`)
+	mermaidDeclare    = regexp.MustCompile(`^state\s+(\S+)$`)
+	mermaidDescribe   = regexp.MustCompile(`^([A-Za-z0-9_.\-]+)\s*:\s*(.*)$`)
+	mermaidBare       = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+	mermaidID         = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	mermaidLabel      = regexp.MustCompile(`^([^\[/]*?)\s*(?:\[([^\]]*)\])?\s*(?:/\s*(.*))?$`)
+)
+
+// mermaidScope is a composite state being parsed, or the diagram itself.
+type mermaidScope struct {
+	name     State
+	sections []*mermaidSection
+}
+
+// mermaidSection is the content of a composite state between "--" separators.
+type mermaidSection struct {
+	states  []State
+	initial State
+}
+
+func (s *mermaidScope) section() *mermaidSection {
+	return s.sections[len(s.sections)-1]
+}
+
+// mermaidParser turns the lines of a diagram into a machine skeleton.
+type mermaidParser struct {
+	scopes      map[State]*mermaidScope
+	stack       []*mermaidScope
+	parent      map[State]State
+	history     map[State]HistoryType
+	final       map[State]bool
+	names       map[State]State // names of the states declared as state "name" as id, by id
+	order       []State
+	transitions []mermaidEdge
+	errs        []error
+}
+
+type mermaidEdge struct {
+	line     int
+	from, to State
+	label    string
+}
+
+func (p *mermaidParser) fail(line int, err error) {
+	p.errs = append(p.errs, &LoadError{Line: line, Column: 1, Err: err})
+}
+
+func (p *mermaidParser) scope() *mermaidScope {
+	return p.stack[len(p.stack)-1]
+}
+
+// name returns the name of the state an identifier in the diagram refers to.
+func (p *mermaidParser) name(id State) State {
+	if name, ok := p.names[id]; ok {
+		return name
+	}
+	return id
+}
+
+// declare records a state in the current scope the first time it is seen.
+func (p *mermaidParser) declare(state State) {
+	if _, seen := p.parent[state]; seen {
+		return
+	}
+	scope := p.scope()
+	p.parent[state] = scope.name
+	p.order = append(p.order, state)
+	section := scope.section()
+	section.states = append(section.states, state)
+}
+
+func (p *mermaidParser) parseLine(n int, line string) {
+	switch {
+	case line == "" || strings.HasPrefix(line, "%%"):
+	case strings.HasPrefix(line, "stateDiagram"), strings.HasPrefix(line, "direction "):
+	case line == "}":
+		if len(p.stack) == 1 {
+			p.fail(n, errors.New("unexpected '}'"))
+			return
+		}
+		p.stack = p.stack[:len(p.stack)-1]
+	case line == "--":
+		scope := p.scope()
+		if scope.name == "" {
+			p.fail(n, errors.New("'--' outside of a composite state"))
+			return
+		}
+		scope.sections = append(scope.sections, &mermaidSection{})
+	case strings.HasPrefix(line, "note ") || strings.HasPrefix(line, "classDef ") || strings.HasPrefix(line, "class "):
+		p.fail(n, fmt.Errorf("unsupported statement %q", line))
+	case strings.Contains(line, "<<") && !mermaidAlias.MatchString(line):
+		p.fail(n, fmt.Errorf("unsupported pseudo-state in %q", line))
+	default:
+		p.parseStatement(n, line)
+	}
+}
+
+func (p *mermaidParser) parseStatement(n int, line string) {
+	if m := mermaidComposite.FindStringSubmatch(line); m != nil {
+		state := State(m[1])
+		p.declare(state)
+		if p.parent[state] != p.scope().name {
+			p.fail(n, fmt.Errorf("state %q already declared in another scope", state))
+			return
+		}
+		scope, ok := p.scopes[state]
+		if !ok {
+			scope = &mermaidScope{name: state, sections: []*mermaidSection{{}}}
+			p.scopes[state] = scope
+		}
+		p.stack = append(p.stack, scope)
+		return
+	}
+	if m := mermaidAlias.FindStringSubmatch(line); m != nil {
+		switch m[1] {
+		case "H":
+			p.declare(State(m[2]))
+			p.history[State(m[2])] = HistoryShallow
+		case "H*":
+			p.declare(State(m[2]))
+			p.history[State(m[2])] = HistoryDeep
+		default:
+			p.declare(State(m[2]))
+			p.names[State(m[2])] = State(m[1])
+		}
+		return
+	}
+	if m := mermaidDeclare.FindStringSubmatch(line); m != nil {
+		p.declare(State(m[1]))
+		return
+	}
+	if m := mermaidTransition.FindStringSubmatch(line); m != nil {
+		p.parseTransition(n, m[1], m[2], m[3])
+		return
+	}
+	if m := mermaidDescribe.FindStringSubmatch(line); m != nil {
+		p.declare(State(m[1]))
+		return
+	}
+	if mermaidBare.MatchString(line) {
+		p.declare(State(line))
+		return
+	}
+	p.fail(n, fmt.Errorf("cannot parse %q", line))
+}
+
+func (p *mermaidParser) parseTransition(n int, from, to, label string) {
+	switch {
+	case from == "[*]" && to == "[*]":
+		p.fail(n, errors.New("transition from [*] to [*]"))
+	case from == "[*]":
+		state := State(to)
+		p.declare(state)
+		section := p.scope().section()
+		if section.initial != "" && section.initial != state {
+			p.fail(n, fmt.Errorf("second initial state %q", state))
+			return
+		}
+		section.initial = state
+	case to == "[*]":
+		state := State(from)
+		p.declare(state)
+		p.final[state] = true
+	default:
+		p.declare(State(from))
+		p.declare(State(to))
+		p.transitions = append(p.transitions, mermaidEdge{line: n, from: State(from), to: State(to), label: label})
+	}
+}
+
+// ParseMermaid builds a machine skeleton from a Mermaid stateDiagram-v2, as written by
+// WriteMermaid or by hand. Composite states become nested states, "--" separated sections
+// become parallel regions, "[*]" marks initial and final states, and states described as "H"
+// or "H*" become history pseudo-states; any other description is the name of the state, which
+// the rest of the diagram refers to by its alias. Parallel sections that do not consist of a
+// single composite state are wrapped in regions named after their parent and position.
+//
+// Transition labels are read as "event [guard] / action, action". Guard and action names are
+// resolved against registry; if registry is nil they are kept with nil functions so the
+// definition can be completed in Go. Notes, classes and other pseudo-states are not supported
+// and are reported as *LoadError values with their line number.
+func ParseMermaid[T any](r io.Reader, registry *Registry[T], opts ...FSMOptionFunc) (*FSM[T], error) {
+	root := &mermaidScope{sections: []*mermaidSection{{}}}
+	p := &mermaidParser{
+		scopes:  map[State]*mermaidScope{"": root},
+		stack:   []*mermaidScope{root},
+		parent:  make(map[State]State),
+		history: make(map[State]HistoryType),
+		final:   make(map[State]bool),
+		names:   make(map[State]State),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		p.parseLine(n, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p.stack) != 1 {
+		p.fail(0, fmt.Errorf("unterminated composite state %q", p.scope().name))
+	}
+	if len(p.order) == 0 {
+		p.fail(0, errors.New("diagram has no states"))
+	}
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+
+	initial := root.section().initial
+	if initial == "" {
+		initial = root.section().states[0]
+	}
+
+	fsm := newFSM[T](p.name(initial), opts)
+	registerMermaid(p, fsm, "", root.section().states)
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+	fsm.resetInitial()
+
+	for _, edge := range p.transitions {
+		m := mermaidLabel.FindStringSubmatch(strings.TrimSpace(edge.label))
+		event, guard, actions := Event(strings.TrimSpace(m[1])), strings.TrimSpace(m[2]), m[3]
+		if event == "" {
+			p.fail(edge.line, errors.New("transition without an event"))
+			continue
+		}
+
+		var transitionOpts []TransitionOptionFunc[T]
+		if guard != "" {
+			fn, ok := registry.lookupGuard(guard)
+			if !ok {
+				p.fail(edge.line, &ActionError{ActionName: guard, Err: ErrUnknownGuard})
+				continue
+			}
+			transitionOpts = append(transitionOpts, WithGuard(guard, fn))
+		}
+
+		var list []Action[T]
+		for _, name := range strings.Split(actions, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			action, ok := registry.lookupAction(name)
+			if !ok {
+				p.fail(edge.line, &ActionError{ActionName: name, Err: ErrUnknownAction})
+				continue
+			}
+			list = append(list, action)
+		}
+		if err := fsm.addTransition(p.name(edge.from), p.name(edge.to), event, list, transitionOpts...); err != nil {
+			p.fail(edge.line, err)
+		}
+	}
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+	return fsm, nil
+}
+
+// registerMermaid registers the states with the given identifiers under parent, recursing into
+// composite states. Within a composite state the section's initial state is registered first so
+// it becomes the initial substate.
+func registerMermaid[T any](p *mermaidParser, fsm *FSM[T], parent State, states []State) {
+	for _, state := range states {
+		opts := []StateOptionFunc{}
+		if parent != "" {
+			opts = append(opts, WithParent(parent))
+		}
+		if kind, ok := p.history[state]; ok {
+			opts = append(opts, WithHistory(kind))
+		}
+		if p.final[state] {
+			opts = append(opts, Final())
+		}
+		scope, composite := p.scopes[state]
+		if composite && len(scope.sections) > 1 {
+			opts = append(opts, Parallel())
+		}
+		name := p.name(state)
+		if err := fsm.RegisterState(name, opts...); err != nil {
+			p.fail(0, err)
+			continue
+		}
+		if !composite {
+			continue
+		}
+
+		if len(scope.sections) == 1 {
+			registerMermaid(p, fsm, name, initialFirst(scope.sections[0]))
+			continue
+		}
+		for i, region := range scope.sections {
+			if len(region.states) == 1 {
+				if _, ok := p.scopes[region.states[0]]; ok {
+					registerMermaid(p, fsm, name, region.states)
+					continue
+				}
+			}
+			regionName := State(fmt.Sprintf("%s_%d", name, i+1))
+			if err := fsm.RegisterState(regionName, WithParent(name)); err != nil {
+				p.fail(0, err)
+				continue
+			}
+			registerMermaid(p, fsm, regionName, initialFirst(region))
+		}
+	}
+}
+
+// initialFirst returns the states of a section with its initial state moved to the front.
+func initialFirst(section *mermaidSection) []State {
+	states := []State{}
+	if section.initial != "" {
+		states = append(states, section.initial)
+	}
+	for _, state := range section.states {
+		if state != section.initial {
+			states = append(states, state)
+		}
+	}
+	return states
+}
@@ -0,0 +1,202 @@
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_WriteMermaid(t *testing.T) {
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("fulfilment")))
+	assert.NoError(t, fsm.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("packing"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("resume"), WithParent(State("fulfilment")), WithHistory(HistoryDeep)))
+	assert.NoError(t, fsm.RegisterState(State("tracking"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("carrier"), WithParent(State("tracking"))))
+	assert.NoError(t, fsm.RegisterState(State("in_transit"), WithParent(State("carrier"))))
+	assert.NoError(t, fsm.RegisterState(State("customer"), WithParent(State("tracking"))))
+	assert.NoError(t, fsm.RegisterState(State("unnotified"), WithParent(State("customer"))))
+	assert.NoError(t, fsm.RegisterState(State("delivered"), Final()))
+
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+	fsm.AddTransition(State("cart"), State("fulfilment"), Event("pay"),
+		[]Action[TestData]{{Name: "charge", Fn: noop}, {Name: "email", Fn: noop}},
+		WithGuard("in_stock", func(ctx context.Context, args *TestData) bool { return true }))
+	fsm.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	fsm.AddTransition(State("packing"), State("tracking"), Event("shipped"), nil)
+	fsm.AddTransition(State("tracking"), State("delivered"), Event("signed"), nil)
+
+	var buf bytes.Buffer
+	assert.NoError(t, fsm.WriteMermaid(&buf))
+
+	expected := `stateDiagram-v2
+  [*] --> cart
+  cart
+  state fulfilment {
+    [*] --> picking
+    picking
+    packing
+    state "H*" as resume
+  }
+  state tracking {
+    state carrier {
+      [*] --> in_transit
+      in_transit
+    }
+    --
+    state customer {
+      [*] --> unnotified
+      unnotified
+    }
+  }
+  delivered
+  delivered --> [*]
+  cart --> fulfilment : pay [in_stock] / charge, email
+  picking --> packing : picked
+  packing --> tracking : shipped
+  tracking --> delivered : signed
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+// describeStates summarises the structure of a machine for comparison.
+func describeStates(fsm *FSM[TestData]) []string {
+	var out []string
+	for _, s := range fsm.states.Keys() {
+		info := fsm.states.stateMap[s]
+		out = append(out, strings.Join([]string{
+			string(s), string(info.Parent),
+			map[bool]string{true: "parallel"}[info.Parallel],
+			map[bool]string{true: "final"}[info.Final],
+			map[HistoryType]string{HistoryShallow: "H", HistoryDeep: "H*"}[info.History],
+		}, "|"))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestParseMermaid_RoundTrip(t *testing.T) {
+	original := New[TestData](State("cart"))
+	assert.NoError(t, original.RegisterState(State("fulfilment")))
+	assert.NoError(t, original.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, original.RegisterState(State("packing"), WithParent(State("fulfilment"))))
+	assert.NoError(t, original.RegisterState(State("resume"), WithParent(State("fulfilment")), WithHistory(HistoryDeep)))
+	assert.NoError(t, original.RegisterState(State("tracking"), Parallel()))
+	assert.NoError(t, original.RegisterState(State("carrier"), WithParent(State("tracking"))))
+	assert.NoError(t, original.RegisterState(State("in_transit"), WithParent(State("carrier"))))
+	assert.NoError(t, original.RegisterState(State("customer"), WithParent(State("tracking"))))
+	assert.NoError(t, original.RegisterState(State("unnotified"), WithParent(State("customer"))))
+	assert.NoError(t, original.RegisterState(State("delivered"), Final()))
+
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+	original.AddTransition(State("cart"), State("fulfilment"), Event("pay"),
+		[]Action[TestData]{{Name: "charge", Fn: noop}, {Name: "email", Fn: noop}},
+		WithGuard("in_stock", func(ctx context.Context, args *TestData) bool { return true }))
+	original.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	original.AddTransition(State("packing"), State("tracking"), Event("shipped"), nil)
+	original.AddTransition(State("tracking"), State("delivered"), Event("signed"), nil)
+
+	var buf bytes.Buffer
+	assert.NoError(t, original.WriteMermaid(&buf))
+
+	parsed, err := ParseMermaid[TestData](strings.NewReader(buf.String()), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, describeStates(original), describeStates(parsed))
+	assert.Equal(t, original.initial, parsed.initial)
+
+	assert.Len(t, parsed.transitions, len(original.transitions))
+	for i := range original.transitions {
+		assert.Equal(t, transitionLabel(&original.transitions[i]), transitionLabel(&parsed.transitions[i]))
+		assert.Equal(t, original.transitions[i].From, parsed.transitions[i].From)
+		assert.Equal(t, original.transitions[i].To, parsed.transitions[i].To)
+	}
+
+	var again bytes.Buffer
+	assert.NoError(t, parsed.WriteMermaid(&again))
+	assert.Equal(t, buf.String(), again.String())
+}
+
+func TestParseMermaid_RoundTripQuotedNames(t *testing.T) {
+	fsm := New[TestData](State("awaiting payment"))
+	assert.NoError(t, fsm.RegisterState(State("s1")))
+	assert.NoError(t, fsm.RegisterState(State("in-transit --> out: {x}")))
+	assert.NoError(t, fsm.RegisterState(State("leg 1 <<fast>>"), WithParent(State("in-transit --> out: {x}"))))
+	assert.NoError(t, fsm.RegisterState(State("done"), WithParent(State("in-transit --> out: {x}")), Final()))
+	fsm.AddTransition(State("awaiting payment"), State("s1"), Event("pay"), nil)
+	fsm.AddTransition(State("s1"), State("in-transit --> out: {x}"), Event("ship"), nil)
+	fsm.AddTransition(State("leg 1 <<fast>>"), State("done"), Event("arrive"), nil)
+
+	var buf bytes.Buffer
+	assert.NoError(t, fsm.WriteMermaid(&buf))
+	assert.Contains(t, buf.String(), `state "awaiting payment" as s2`)
+
+	parsed, err := ParseMermaid[TestData](strings.NewReader(buf.String()), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, describeStates(fsm), describeStates(parsed))
+	assert.Equal(t, State("awaiting payment"), parsed.initial)
+	for i := range fsm.transitions {
+		assert.Equal(t, fsm.transitions[i].From, parsed.transitions[i].From)
+		assert.Equal(t, fsm.transitions[i].To, parsed.transitions[i].To)
+	}
+
+	var again bytes.Buffer
+	assert.NoError(t, parsed.WriteMermaid(&again))
+	assert.Equal(t, buf.String(), again.String())
+
+	assert.NoError(t, fsm.RegisterState(State(`say "hi"`)))
+	assert.ErrorIs(t, fsm.WriteMermaid(&bytes.Buffer{}), ErrUnsupportedConstruct)
+}
+
+func TestParseMermaid_HandWritten(t *testing.T) {
+	diagram := `stateDiagram-v2
+    %% a designer's sketch
+    [*] --> Idle
+    Idle --> Running : start / warm_up
+    state Running {
+        [*] --> Fast
+        Slow --> Fast : speed_up
+        --
+        Quiet --> Loud : shout
+    }
+    Running --> [*] : stop
+`
+	registry := NewRegistry[TestData]()
+	registry.RegisterAction("warm_up", func(ctx context.Context, args *TestData) (*TestData, error) {
+		args.Counter++
+		return args, nil
+	})
+
+	fsm, err := ParseMermaid(strings.NewReader(diagram), registry)
+	assert.NoError(t, err)
+	assert.True(t, fsm.states.IsParallel(State("Running")))
+	assert.Equal(t, []State{"Fast", "Slow"}, fsm.states.Children(State("Running_1")))
+
+	data := &TestData{}
+	_, err = fsm.Trigger(context.Background(), Event("start"), data)
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"Running", "Running_1", "Fast", "Running_2", "Quiet"}, fsm.Configuration())
+	assert.Equal(t, 1, data.Counter)
+}
+
+func TestParseMermaid_Errors(t *testing.T) {
+	diagram := `stateDiagram-v2
+    [*] --> A
+    note right of A : hello
+    A --> B : go / launch
+`
+	_, err := ParseMermaid(strings.NewReader(diagram), NewRegistry[TestData]())
+	var loadErr *LoadError
+	assert.ErrorAs(t, err, &loadErr)
+	assert.Equal(t, 3, loadErr.Line)
+
+	diagram = strings.Replace(diagram, "    note right of A : hello\n", "", 1)
+	_, err = ParseMermaid(strings.NewReader(diagram), NewRegistry[TestData]())
+	assert.ErrorIs(t, err, ErrUnknownAction)
+	assert.ErrorAs(t, err, &loadErr)
+	assert.Equal(t, 3, loadErr.Line)
+}
@@ -0,0 +1,363 @@
+package nexus
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsExporter receives the measurements of an FSM. Set one with WithMetrics; Metrics is
+// the built-in implementation.
+type MetricsExporter interface {
+	// CountTransition counts an event processed in state from, leaving the FSM in state to.
+	CountTransition(from, to State, event Event, outcome Outcome)
+	// ObserveAction records how long an action or hook took.
+	ObserveAction(action string, d time.Duration)
+	// ObserveTimeInState records how long the FSM stayed in a state, once it leaves it.
+	ObserveTimeInState(state State, d time.Duration)
+}
+
+// WithMetrics sends the measurements of the FSM to m. Durations are measured with the FSM
+// clock. Nothing is measured while replaying a journal.
+func WithMetrics(m MetricsExporter) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Metrics = m
+	}
+}
+
+// countTransition counts a processed event, or holds it back until the state it led to is
+// saved.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) countTransition(from, to State, event Event, outcome Outcome) {
+	if f.unsaved != nil {
+		f.unsaved.counts = append(f.unsaved.counts, transitionCount{from: from, to: to, event: event, outcome: outcome})
+		return
+	}
+	f.Metrics.CountTransition(from, to, event, outcome)
+}
+
+// trackStates reports the time spent in the exited states and starts timing the entered ones.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) trackStates(exited, entered []State) {
+	if f.Metrics == nil || f.replay != nil {
+		return
+	}
+	now := f.Clock.Now()
+	for _, state := range exited {
+		if since, ok := f.entered[state]; ok {
+			f.Metrics.ObserveTimeInState(state, now.Sub(since))
+			delete(f.entered, state)
+		}
+	}
+	for _, state := range entered {
+		f.entered[state] = now
+	}
+}
+
+// trackJump times a change of the active leaves that bypassed the transition mechanism, as
+// leaving every state that was active and entering every state that is.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) trackJump(before []State) {
+	if f.Metrics == nil {
+		return
+	}
+	f.trackStates(f.states.active(before), f.states.active(f.active))
+}
+
+// restartStateTimes starts timing every active state afresh without reporting the time spent
+// so far, for when the FSM is restored from a snapshot.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) restartStateTimes() {
+	if f.Metrics == nil {
+		return
+	}
+	clear(f.entered)
+	f.trackStates(nil, f.states.active(f.active))
+}
+
+// DefaultActionBuckets are the upper bounds, in seconds, of the action latency histograms.
+var DefaultActionBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultStateBuckets are the upper bounds, in seconds, of the time in state histograms.
+var DefaultStateBuckets = []float64{1, 10, 60, 300, 900, 3600, 4 * 3600, 24 * 3600, 7 * 24 * 3600}
+
+// MetricsOptionFunc configures Metrics.
+type MetricsOptionFunc func(*Metrics)
+
+// WithActionBuckets sets the upper bounds, in seconds, of the action latency histograms.
+func WithActionBuckets(bounds ...float64) MetricsOptionFunc {
+	return func(m *Metrics) {
+		m.actionBuckets = bounds
+	}
+}
+
+// WithStateBuckets sets the upper bounds, in seconds, of the time in state histograms.
+func WithStateBuckets(bounds ...float64) MetricsOptionFunc {
+	return func(m *Metrics) {
+		m.stateBuckets = bounds
+	}
+}
+
+// Metrics aggregates the measurements of one machine in memory: transitions counted by source,
+// target, event and outcome, and histograms of action latency and time in state. Share one
+// Metrics between the instances of a definition. Expvar and PrometheusHandler publish it.
+type Metrics struct {
+	machine       string
+	actionBuckets []float64
+	stateBuckets  []float64
+
+	mu          sync.Mutex
+	transitions map[TransitionCount]uint64
+	actions     map[string]*histogram
+	states      map[State]*histogram
+}
+
+// NewMetrics creates Metrics for the named machine. The name is exported as the machine label.
+func NewMetrics(machine string, opts ...MetricsOptionFunc) *Metrics {
+	m := &Metrics{
+		machine:       machine,
+		actionBuckets: DefaultActionBuckets,
+		stateBuckets:  DefaultStateBuckets,
+		transitions:   make(map[TransitionCount]uint64),
+		actions:       make(map[string]*histogram),
+		states:        make(map[State]*histogram),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// CountTransition implements MetricsExporter.
+func (m *Metrics) CountTransition(from, to State, event Event, outcome Outcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transitions[TransitionCount{From: from, To: to, Event: event, Outcome: outcome}]++
+}
+
+// ObserveAction implements MetricsExporter.
+func (m *Metrics) ObserveAction(action string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.actions[action]
+	if !ok {
+		h = newHistogram(m.actionBuckets)
+		m.actions[action] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// ObserveTimeInState implements MetricsExporter.
+func (m *Metrics) ObserveTimeInState(state State, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.states[state]
+	if !ok {
+		h = newHistogram(m.stateBuckets)
+		m.states[state] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// TransitionCount is the number of events processed with the same source, target, event and
+// outcome.
+type TransitionCount struct {
+	From    State   `json:"from"`
+	To      State   `json:"to"`
+	Event   Event   `json:"event"`
+	Outcome Outcome `json:"outcome"`
+	Count   uint64  `json:"count"`
+}
+
+// HistogramSnapshot is the content of a histogram. Durations are in seconds.
+type HistogramSnapshot struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	// Buckets holds the number of observations less than or equal to each upper bound.
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Bucket is a cumulative histogram bucket.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// MetricsSnapshot is the content of Metrics at one point in time.
+type MetricsSnapshot struct {
+	Machine string `json:"machine"`
+	// Transitions are sorted by source, target, event and outcome.
+	Transitions []TransitionCount            `json:"transitions"`
+	Actions     map[string]HistogramSnapshot `json:"actions"`
+	States      map[State]HistogramSnapshot  `json:"states"`
+}
+
+// Snapshot returns a copy of the current measurements.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap := MetricsSnapshot{
+		Machine:     m.machine,
+		Transitions: make([]TransitionCount, 0, len(m.transitions)),
+		Actions:     make(map[string]HistogramSnapshot, len(m.actions)),
+		States:      make(map[State]HistogramSnapshot, len(m.states)),
+	}
+	for key, count := range m.transitions {
+		key.Count = count
+		snap.Transitions = append(snap.Transitions, key)
+	}
+	sort.Slice(snap.Transitions, func(i, j int) bool {
+		a, b := snap.Transitions[i], snap.Transitions[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Event != b.Event {
+			return a.Event < b.Event
+		}
+		return a.Outcome < b.Outcome
+	})
+	for name, h := range m.actions {
+		snap.Actions[name] = h.snapshot()
+	}
+	for state, h := range m.states {
+		snap.States[state] = h.snapshot()
+	}
+	return snap
+}
+
+// Expvar returns the metrics as an expvar variable, to be published with expvar.Publish. Its
+// value is the JSON encoding of a MetricsSnapshot.
+func (m *Metrics) Expvar() expvar.Var {
+	return expvar.Func(func() any {
+		return m.Snapshot()
+	})
+}
+
+// PrometheusHandler serves the given metrics in the Prometheus text exposition format.
+func PrometheusHandler(metrics ...*Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		snaps := make([]MetricsSnapshot, len(metrics))
+		for i, m := range metrics {
+			snaps[i] = m.Snapshot()
+		}
+		_ = WritePrometheus(w, snaps...)
+	})
+}
+
+// WritePrometheus writes metrics snapshots in the Prometheus text exposition format.
+func WritePrometheus(w io.Writer, snaps ...MetricsSnapshot) error {
+	bw := bufio.NewWriter(w)
+	x := &lineWriter{w: bw}
+
+	x.line(0, "# HELP nexus_transitions_total Events processed, by source state, target state, event and outcome.")
+	x.line(0, "# TYPE nexus_transitions_total counter")
+	for _, snap := range snaps {
+		for _, t := range snap.Transitions {
+			x.line(0, "nexus_transitions_total%s %d", promLabels(
+				"machine", snap.Machine, "from", string(t.From), "to", string(t.To),
+				"event", string(t.Event), "outcome", string(t.Outcome)), t.Count)
+		}
+	}
+
+	x.line(0, "# HELP nexus_action_duration_seconds Time taken by actions and hooks.")
+	x.line(0, "# TYPE nexus_action_duration_seconds histogram")
+	for _, snap := range snaps {
+		for _, name := range sortedKeys(snap.Actions) {
+			writePromHistogram(x, "nexus_action_duration_seconds", snap.Actions[name], "machine", snap.Machine, "action", name)
+		}
+	}
+
+	x.line(0, "# HELP nexus_state_duration_seconds Time spent in a state before leaving it.")
+	x.line(0, "# TYPE nexus_state_duration_seconds histogram")
+	for _, snap := range snaps {
+		for _, state := range sortedKeys(snap.States) {
+			writePromHistogram(x, "nexus_state_duration_seconds", snap.States[state], "machine", snap.Machine, "state", string(state))
+		}
+	}
+
+	if x.err != nil {
+		return x.err
+	}
+	return bw.Flush()
+}
+
+func writePromHistogram(x *lineWriter, name string, h HistogramSnapshot, labels ...string) {
+	for _, b := range h.Buckets {
+		x.line(0, "%s_bucket%s %d", name, promLabels(append(labels, "le", promFloat(b.UpperBound))...), b.Count)
+	}
+	x.line(0, "%s_bucket%s %d", name, promLabels(append(labels, "le", "+Inf")...), h.Count)
+	x.line(0, "%s_sum%s %s", name, promLabels(labels...), promFloat(h.Sum))
+	x.line(0, "%s_count%s %d", name, promLabels(labels...), h.Count)
+}
+
+// promLabels formats label name and value pairs, leaving out empty values.
+func promLabels(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], promEscaper.Replace(pairs[i+1])))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// histogram counts observations in buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	snap := HistogramSnapshot{Count: h.count, Sum: h.sum, Buckets: make([]Bucket, len(h.bounds))}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		snap.Buckets[i] = Bucket{UpperBound: bound, Count: cumulative}
+	}
+	return snap
+}
@@ -0,0 +1,157 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Collects(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	metrics := NewMetrics("orders", WithActionBuckets(0.1, 1), WithStateBuckets(60, 3600))
+	fsm := New[TestData](State("cart"), WithClock(clock), WithMetrics(metrics))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.SetErrorHandler(State("failed"), nil)
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			clock.Advance(200 * time.Millisecond)
+			if args.Value == "declined" {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	fsm.AddTransition(State("paid"), State("cart"), Event("refund"), nil)
+	ctx := context.Background()
+
+	clock.Advance(30 * time.Second)
+	_, err := fsm.Trigger(ctx, Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	clock.Advance(2 * time.Hour)
+	_, err = fsm.Trigger(ctx, Event("refund"), &TestData{})
+	assert.NoError(t, err)
+	_, err = fsm.Trigger(ctx, Event("pay"), &TestData{Value: "declined"})
+	assert.Error(t, err)
+	_, err = fsm.Trigger(ctx, Event("refund"), &TestData{})
+	assert.Error(t, err)
+
+	snap := metrics.Snapshot()
+	assert.Equal(t, "orders", snap.Machine)
+	assert.Equal(t, []TransitionCount{
+		{From: "cart", To: "failed", Event: "pay", Outcome: OutcomeFailed, Count: 1},
+		{From: "cart", To: "paid", Event: "pay", Outcome: OutcomeOK, Count: 1},
+		{From: "failed", To: "failed", Event: "refund", Outcome: OutcomeNoTransition, Count: 1},
+		{From: "paid", To: "cart", Event: "refund", Outcome: OutcomeOK, Count: 1},
+	}, snap.Transitions)
+
+	charge := snap.Actions["charge"]
+	assert.Equal(t, uint64(2), charge.Count)
+	assert.InDelta(t, 0.4, charge.Sum, 1e-9)
+	assert.Equal(t, []Bucket{{UpperBound: 0.1, Count: 0}, {UpperBound: 1, Count: 2}}, charge.Buckets)
+
+	// cart: 30s then 200ms before failing into the error state; paid: 2h.
+	assert.Equal(t, uint64(2), snap.States["cart"].Count)
+	assert.InDelta(t, 30.4, snap.States["cart"].Sum, 1e-9)
+	assert.Equal(t, []Bucket{{UpperBound: 60, Count: 0}, {UpperBound: 3600, Count: 0}}, snap.States["paid"].Buckets)
+	assert.Equal(t, uint64(1), snap.States["paid"].Count)
+}
+
+func TestMetrics_NestedStates(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	metrics := NewMetrics("orders")
+	fsm := New[TestData](State("cart"), WithClock(clock), WithMetrics(metrics))
+	assert.NoError(t, fsm.RegisterState(State("fulfilment")))
+	assert.NoError(t, fsm.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("packing"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("shipped")))
+	fsm.AddTransition(State("cart"), State("fulfilment"), Event("pay"), nil)
+	fsm.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	fsm.AddTransition(State("fulfilment"), State("shipped"), Event("ship"), nil)
+
+	ctx := context.Background()
+	for _, step := range []struct {
+		event Event
+		after time.Duration
+	}{{"pay", time.Minute}, {"picked", 10 * time.Minute}, {"ship", 5 * time.Minute}} {
+		clock.Advance(step.after)
+		_, err := fsm.Trigger(ctx, step.event, &TestData{})
+		assert.NoError(t, err)
+	}
+
+	// A parent state is timed from entering it to leaving it, across moves between its substates.
+	states := metrics.Snapshot().States
+	assert.InDelta(t, 60, states["cart"].Sum, 1e-9)
+	assert.InDelta(t, 600, states["picking"].Sum, 1e-9)
+	assert.InDelta(t, 300, states["packing"].Sum, 1e-9)
+	assert.InDelta(t, 900, states["fulfilment"].Sum, 1e-9)
+	assert.Equal(t, uint64(1), states["fulfilment"].Count)
+	assert.NotContains(t, states, "shipped")
+}
+
+func TestMetrics_Prometheus(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	metrics := NewMetrics("orders", WithActionBuckets(0.1, 1), WithStateBuckets(60))
+	fsm := New[TestData](State("cart"), WithClock(clock), WithMetrics(metrics))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.SetErrorHandler(State("failed"), nil)
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			clock.Advance(200 * time.Millisecond)
+			if args.Value == "declined" {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	fsm.AddTransition(State("paid"), State("cart"), Event("refund"), nil)
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler(metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body, _ := io.ReadAll(rec.Body)
+	expected := `# HELP nexus_transitions_total Events processed, by source state, target state, event and outcome.
+# TYPE nexus_transitions_total counter
+nexus_transitions_total{machine="orders",from="cart",to="paid",event="pay",outcome="ok"} 1
+# HELP nexus_action_duration_seconds Time taken by actions and hooks.
+# TYPE nexus_action_duration_seconds histogram
+nexus_action_duration_seconds_bucket{machine="orders",action="charge",le="0.1"} 0
+nexus_action_duration_seconds_bucket{machine="orders",action="charge",le="1"} 1
+nexus_action_duration_seconds_bucket{machine="orders",action="charge",le="+Inf"} 1
+nexus_action_duration_seconds_sum{machine="orders",action="charge"} 0.2
+nexus_action_duration_seconds_count{machine="orders",action="charge"} 1
+# HELP nexus_state_duration_seconds Time spent in a state before leaving it.
+# TYPE nexus_state_duration_seconds histogram
+nexus_state_duration_seconds_bucket{machine="orders",state="cart",le="60"} 1
+nexus_state_duration_seconds_bucket{machine="orders",state="cart",le="+Inf"} 1
+nexus_state_duration_seconds_sum{machine="orders",state="cart"} 0.2
+nexus_state_duration_seconds_count{machine="orders",state="cart"} 1
+`
+	assert.Equal(t, expected, string(body))
+}
+
+func TestMetrics_Expvar(t *testing.T) {
+	metrics := NewMetrics("orders")
+	metrics.CountTransition(State("cart"), State("paid"), Event("pay"), OutcomeOK)
+
+	var snap MetricsSnapshot
+	assert.NoError(t, json.Unmarshal([]byte(metrics.Expvar().String()), &snap))
+	assert.Equal(t, metrics.Snapshot(), snap)
+}
+
+func TestPromLabels_Escapes(t *testing.T) {
+	assert.Equal(t, `{event="say \"hi\"\\\n"}`, promLabels("machine", "", "event", "say \"hi\"\\\n"))
+	assert.Equal(t, "", promLabels("machine", ""))
+}
@@ -0,0 +1,111 @@
+package nexus
+
+import (
+	"context"
+	"fmt"
+)
+
+// Middleware wraps an action to add behaviour around it, such as timing, tracing, panic
+// recovery or input validation. It receives the next function in the chain and returns the
+// function to run in its place. ActionInfoFrom tells it which action it is running.
+type Middleware[T any] func(next ActionFunc[T]) ActionFunc[T]
+
+// ActionKind tells what an action is run for.
+type ActionKind int
+
+const (
+	// ActionKindTransition is an action of a transition.
+	ActionKindTransition ActionKind = iota
+	// ActionKindEntry is an entry hook of a state.
+	ActionKindEntry
+	// ActionKindExit is an exit hook of a state.
+	ActionKindExit
+)
+
+func (k ActionKind) String() string {
+	switch k {
+	case ActionKindEntry:
+		return "entry"
+	case ActionKindExit:
+		return "exit"
+	default:
+		return "transition"
+	}
+}
+
+// ActionInfo describes the action being run.
+type ActionInfo struct {
+	// Action is the name of the action.
+	Action string
+	Kind   ActionKind
+	// State is the state whose hook is run, or the source state of the transition.
+	State State
+	// Event is the event being processed.
+	Event Event
+	// From, To and Guard describe the transition an action of kind ActionKindTransition
+	// belongs to. They are empty for hooks.
+	From  State
+	To    State
+	Guard string
+}
+
+type actionInfoKey struct{}
+
+// ActionInfoFrom returns the description of the action being run, for use by middleware and
+// actions. The second result is false if ctx does not come from a running action.
+func ActionInfoFrom(ctx context.Context) (ActionInfo, bool) {
+	info, ok := ctx.Value(actionInfoKey{}).(ActionInfo)
+	return info, ok
+}
+
+// WithMiddleware wraps every action of a transition in mw.
+func WithMiddleware[T any](mw ...Middleware[T]) TransitionOptionFunc[T] {
+	return func(t *Transition[T]) {
+		t.Middleware = append(t.Middleware, mw...)
+	}
+}
+
+// Use wraps every action and hook of the machine in mw.
+//
+// Middleware is composed from the outside in: machine middleware in the order passed to Use,
+// then the middleware of the transition, then the middleware of the action, and finally the
+// action itself. Hooks are only wrapped in machine and action middleware.
+func (d *Definition[T]) Use(mw ...Middleware[T]) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.mutable("Use", ""); err != nil {
+		return err
+	}
+	d.middleware = append(d.middleware, mw...)
+	return nil
+}
+
+// Recover returns middleware that turns a panic in an action into an ActionError wrapping
+// ErrActionPanicked, which then follows the usual error path.
+func Recover[T any]() Middleware[T] {
+	return func(next ActionFunc[T]) ActionFunc[T] {
+		return func(ctx context.Context, args *T) (result *T, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					info, _ := ActionInfoFrom(ctx)
+					result, err = args, &ActionError{
+						ActionName: info.Action,
+						State:      string(info.State),
+						Event:      string(info.Event),
+						Err:        fmt.Errorf("%w: %v", ErrActionPanicked, r),
+					}
+				}
+			}()
+			return next(ctx, args)
+		}
+	}
+}
+
+// chain wraps fn in mw, the first middleware being the outermost.
+func chain[T any](fn ActionFunc[T], mw []Middleware[T]) ActionFunc[T] {
+	for i := len(mw) - 1; i >= 0; i-- {
+		fn = mw[i](fn)
+	}
+	return fn
+}
@@ -0,0 +1,133 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tagMiddleware records its name before and after the rest of the chain.
+func tagMiddleware(name string, calls *[]string) Middleware[TestData] {
+	return func(next ActionFunc[TestData]) ActionFunc[TestData] {
+		return func(ctx context.Context, args *TestData) (*TestData, error) {
+			info, _ := ActionInfoFrom(ctx)
+			*calls = append(*calls, name+">"+info.Action)
+			args, err := next(ctx, args)
+			*calls = append(*calls, name+"<"+info.Action)
+			return args, err
+		}
+	}
+}
+
+func TestFSM_Middleware_Order(t *testing.T) {
+	var calls []string
+	action := func(name string) Action[TestData] {
+		return Action[TestData]{Name: name, Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			calls = append(calls, name)
+			return args, nil
+		}}
+	}
+
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.Use(tagMiddleware("m1", &calls), tagMiddleware("m2", &calls)))
+
+	charge := action("charge")
+	charge.Middleware = []Middleware[TestData]{tagMiddleware("a", &calls)}
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{charge},
+		WithMiddleware(tagMiddleware("t", &calls)))
+	assert.NoError(t, fsm.OnEnter(State("paid"), action("receipt")))
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"m1>charge", "m2>charge", "t>charge", "a>charge", "charge", "a<charge", "t<charge", "m2<charge", "m1<charge",
+		"m1>receipt", "m2>receipt", "receipt", "m2<receipt", "m1<receipt",
+	}, calls)
+}
+
+func TestFSM_Middleware_ActionInfo(t *testing.T) {
+	var infos []ActionInfo
+	capture := func(next ActionFunc[TestData]) ActionFunc[TestData] {
+		return func(ctx context.Context, args *TestData) (*TestData, error) {
+			info, ok := ActionInfoFrom(ctx)
+			assert.True(t, ok)
+			infos = append(infos, info)
+			return next(ctx, args)
+		}
+	}
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.Use(capture))
+	assert.NoError(t, fsm.OnExit(State("cart"), Action[TestData]{Name: "release", Fn: noop}))
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{Name: "charge", Fn: noop}},
+		WithGuard[TestData]("in_stock", nil))
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []ActionInfo{
+		{Action: "release", Kind: ActionKindExit, State: "cart", Event: "pay"},
+		{Action: "charge", Kind: ActionKindTransition, State: "cart", Event: "pay", From: "cart", To: "paid", Guard: "in_stock"},
+	}, infos)
+
+	_, ok := ActionInfoFrom(context.Background())
+	assert.False(t, ok)
+}
+
+func TestFSM_Middleware_Recover(t *testing.T) {
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.SetErrorHandler(State("failed"), nil)
+	assert.NoError(t, fsm.Use(Recover[TestData]()))
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			panic("card reader on fire")
+		},
+	}})
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.ErrorIs(t, err, ErrActionPanicked)
+	var actionErr *ActionError
+	assert.True(t, errors.As(err, &actionErr))
+	assert.Equal(t, "charge", actionErr.ActionName)
+	assert.Contains(t, err.Error(), "card reader on fire")
+	assert.Equal(t, State("failed"), fsm.GetState())
+}
+
+func TestFSM_Middleware_ShortCircuit(t *testing.T) {
+	errInvalid := errors.New("invalid order")
+	validate := func(next ActionFunc[TestData]) ActionFunc[TestData] {
+		return func(ctx context.Context, args *TestData) (*TestData, error) {
+			if args.Value == "" {
+				return args, errInvalid
+			}
+			return next(ctx, args)
+		}
+	}
+
+	called := false
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			called = true
+			return args, nil
+		},
+	}}, WithMiddleware(validate))
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.ErrorIs(t, err, errInvalid)
+	assert.False(t, called)
+	assert.Equal(t, State("cart"), fsm.GetState())
+
+	_, err = fsm.Trigger(context.Background(), Event("pay"), &TestData{Value: "order-1"})
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
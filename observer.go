@@ -0,0 +1,165 @@
+package nexus
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NotificationKind tells at which point of a transition a notification is sent.
+type NotificationKind int
+
+const (
+	// BeforeTransition is sent once a transition is selected, before any of its actions run.
+	BeforeTransition NotificationKind = iota
+	// AfterTransition is sent once a transition has completed.
+	AfterTransition
+	// TransitionFailed is sent when an action of a transition fails. If an error state is
+	// configured the FSM is already in it.
+	TransitionFailed
+)
+
+func (k NotificationKind) String() string {
+	switch k {
+	case BeforeTransition:
+		return "before"
+	case AfterTransition:
+		return "after"
+	default:
+		return "failed"
+	}
+}
+
+// Notification describes a transition taken by an FSM.
+type Notification struct {
+	Kind NotificationKind
+	// ID is the ID of the instance, empty for an FSM created with New.
+	ID    string
+	Event Event
+	// From is the state the FSM was in and To the state the transition leads to, as returned
+	// by GetState.
+	From State
+	To   State
+	// Duration is the time the actions took, measured with the FSM clock. It is zero for
+	// BeforeTransition.
+	Duration time.Duration
+	// Err is the error of a failed transition.
+	Err error
+	// Dropped is the number of notifications dropped for a slow Watch subscriber since the
+	// previous one it received.
+	Dropped uint64
+}
+
+// ObserverFunc receives the notifications of an FSM.
+type ObserverFunc func(n Notification)
+
+// observers are the observers and subscribers of an FSM.
+type observers struct {
+	obsMu    sync.Mutex
+	count    atomic.Int32 // observers plus subscribers, to skip notify when there are none
+	funcs    []observer
+	nextFunc int
+	subs     map[*subscription]struct{}
+}
+
+// observer is a registered ObserverFunc.
+type observer struct {
+	id int
+	fn ObserverFunc
+}
+
+// subscription is a Watch channel.
+type subscription struct {
+	ch      chan Notification
+	dropped uint64
+}
+
+// Observe registers fn to be called with every notification of the FSM, for every transition
+// taken by Trigger, Send, raised events and timeouts. SetState, Restore and Replay do not
+// notify.
+//
+// fn is called synchronously while the FSM is locked: it must be quick and must not call
+// methods of the FSM. Use Watch to react asynchronously. The returned function removes the
+// observer.
+func (f *FSM[T]) Observe(fn ObserverFunc) (remove func()) {
+	f.obsMu.Lock()
+	defer f.obsMu.Unlock()
+
+	id := f.nextFunc
+	f.nextFunc++
+	f.funcs = append(f.funcs, observer{id: id, fn: fn})
+	f.count.Add(1)
+
+	return func() {
+		f.obsMu.Lock()
+		defer f.obsMu.Unlock()
+		for i, o := range f.funcs {
+			if o.id == id {
+				f.funcs = append(f.funcs[:i:i], f.funcs[i+1:]...)
+				f.count.Add(-1)
+				return
+			}
+		}
+	}
+}
+
+// Watch returns a channel receiving the AfterTransition and TransitionFailed notifications of
+// the FSM, until ctx is done; the channel is closed then.
+//
+// Watch never slows the FSM down: the channel holds WatchBuffer notifications (see
+// WithWatchBuffer) and, while it is full, new notifications are dropped rather than waited
+// for. The next notification delivered counts the dropped ones in Dropped.
+func (f *FSM[T]) Watch(ctx context.Context) <-chan Notification {
+	sub := &subscription{ch: make(chan Notification, f.WatchBuffer)}
+
+	f.obsMu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[*subscription]struct{})
+	}
+	f.subs[sub] = struct{}{}
+	f.count.Add(1)
+	f.obsMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.obsMu.Lock()
+		defer f.obsMu.Unlock()
+		delete(f.subs, sub)
+		f.count.Add(-1)
+		close(sub.ch)
+	}()
+	return sub.ch
+}
+
+// notify sends a notification to the observers and subscribers.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) notify(n Notification) {
+	if f.count.Load() == 0 || f.replay != nil {
+		return
+	}
+	if f.unsaved != nil && n.Kind != BeforeTransition {
+		f.unsaved.notifications = append(f.unsaved.notifications, n)
+		return
+	}
+
+	f.obsMu.Lock()
+	funcs := f.funcs
+	if n.Kind != BeforeTransition {
+		for sub := range f.subs {
+			delivered := n
+			delivered.Dropped = sub.dropped
+			select {
+			case sub.ch <- delivered:
+				sub.dropped = 0
+			default:
+				sub.dropped++
+			}
+		}
+	}
+	f.obsMu.Unlock()
+
+	for _, o := range funcs {
+		o.fn(n)
+	}
+}
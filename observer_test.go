@@ -0,0 +1,107 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_Observe(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("cart"), WithClock(clock), WithWatchBuffer(2))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.SetErrorHandler(State("failed"), nil)
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			clock.Advance(time.Second)
+			if args.Value == "declined" {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	fsm.AddTransition(State("paid"), State("cart"), Event("refund"), nil)
+
+	var got []Notification
+	remove := fsm.Observe(func(n Notification) { got = append(got, n) })
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Notification{
+		{Kind: BeforeTransition, Event: "pay", From: "cart", To: "paid"},
+		{Kind: AfterTransition, Event: "pay", From: "cart", To: "paid", Duration: time.Second},
+	}, got)
+
+	got = nil
+	_, err = fsm.Trigger(context.Background(), Event("refund"), &TestData{})
+	assert.NoError(t, err)
+	_, err = fsm.Trigger(context.Background(), Event("pay"), &TestData{Value: "declined"})
+	assert.Error(t, err)
+	assert.Len(t, got, 4)
+	assert.Equal(t, TransitionFailed, got[3].Kind)
+	assert.Equal(t, time.Second, got[3].Duration)
+	assert.Equal(t, err, got[3].Err)
+
+	// Events without a transition do not notify.
+	got = nil
+	_, err = fsm.Trigger(context.Background(), Event("unknown"), &TestData{})
+	assert.Error(t, err)
+	assert.Empty(t, got)
+
+	remove()
+	fsm.SetState(State("cart"))
+	_, err = fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestFSM_Watch(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("cart"), WithClock(clock), WithWatchBuffer(2))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.SetErrorHandler(State("failed"), nil)
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			clock.Advance(time.Second)
+			if args.Value == "declined" {
+				return args, errors.New("card declined")
+			}
+			return args, nil
+		},
+	}})
+	fsm.AddTransition(State("paid"), State("cart"), Event("refund"), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := fsm.Watch(ctx)
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+	n := <-changes
+	assert.Equal(t, AfterTransition, n.Kind)
+	assert.Equal(t, State("paid"), n.To)
+
+	// Nobody reads: the buffer of two fills up and the rest is dropped without blocking.
+	for i := 0; i < 3; i++ {
+		_, err = fsm.Trigger(context.Background(), Event("refund"), &TestData{})
+		assert.NoError(t, err)
+		_, err = fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, Event("refund"), (<-changes).Event)
+	assert.Equal(t, Event("pay"), (<-changes).Event)
+
+	_, err = fsm.Trigger(context.Background(), Event("refund"), &TestData{})
+	assert.NoError(t, err)
+	n = <-changes
+	assert.Equal(t, uint64(4), n.Dropped)
+
+	cancel()
+	_, open := <-changes
+	assert.False(t, open)
+}
@@ -0,0 +1,39 @@
+package nexus
+
+import "context"
+
+// eventQueueKey is the context key under which Trigger stores its internal event queue.
+type eventQueueKey struct{}
+
+// eventQueue holds the events raised by actions during a single Trigger call.
+type eventQueue struct {
+	events []Event
+}
+
+func (q *eventQueue) push(event Event) {
+	q.events = append(q.events, event)
+}
+
+func (q *eventQueue) pop() Event {
+	event := q.events[0]
+	q.events = q.events[1:]
+	return event
+}
+
+// Raise queues an internal event on the machine whose transition is running. It is meant to be
+// called from actions and hooks with the context they were given. The event is
+// processed after the current transition completes and before Trigger returns; calling
+// Trigger on the same machine from an action would deadlock instead.
+//
+// Returns ErrNotInTransition if ctx was not passed down from Trigger.
+func Raise(ctx context.Context, event Event) error {
+	queue, ok := ctx.Value(eventQueueKey{}).(*eventQueue)
+	if !ok {
+		return &EventError{
+			Event: string(event),
+			Err:   ErrNotInTransition,
+		}
+	}
+	queue.push(event)
+	return nil
+}
@@ -0,0 +1,61 @@
+package nexus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRaise_FollowUpEvent(t *testing.T) {
+	fsm := New[TestData](State("draft"))
+	fsm.RegisterState(State("validating"))
+	fsm.RegisterState(State("validated"))
+
+	fsm.AddTransition(State("draft"), State("validating"), Event("submit"), []Action[TestData]{{
+		Name: "Validate",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			args.Counter++
+			return args, Raise(ctx, Event("validated"))
+		},
+	}})
+	fsm.AddTransition(State("validating"), State("validated"), Event("validated"), []Action[TestData]{{
+		Name: "Record",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			args.Value = "ok"
+			return args, nil
+		},
+	}})
+
+	result, err := fsm.Trigger(context.Background(), Event("submit"), &TestData{})
+	assert.NoError(t, err)
+	assert.Equal(t, State("validated"), fsm.GetState())
+	assert.Equal(t, 1, result.Counter)
+	assert.Equal(t, "ok", result.Value)
+}
+
+func TestRaise_LoopLimit(t *testing.T) {
+	fsm := New[TestData](State("ping"), WithMaxInternalEvents(5))
+	fsm.RegisterState(State("pong"))
+
+	bounce := func(event Event) []Action[TestData] {
+		return []Action[TestData]{{
+			Name: "Bounce",
+			Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+				args.Counter++
+				return args, Raise(ctx, event)
+			},
+		}}
+	}
+	fsm.AddTransition(State("ping"), State("pong"), Event("hit"), bounce(Event("hit")))
+	fsm.AddTransition(State("pong"), State("ping"), Event("hit"), bounce(Event("hit")))
+
+	result, err := fsm.Trigger(context.Background(), Event("hit"), &TestData{})
+	assert.ErrorIs(t, err, ErrInternalEventLimit)
+	assert.Equal(t, 6, result.Counter)
+}
+
+func TestRaise_OutsideTransition(t *testing.T) {
+	err := Raise(context.Background(), Event("anything"))
+	assert.ErrorIs(t, err, ErrNotInTransition)
+}
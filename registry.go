@@ -0,0 +1,70 @@
+package nexus
+
+// Registry maps names to action and guard functions, so that machine definitions loaded from
+// documents can refer to Go code by name.
+type Registry[T any] struct {
+	actions map[string]ActionFunc[T]
+	guards  map[string]GuardFunc[T]
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry[T any]() *Registry[T] {
+	return &Registry[T]{
+		actions: make(map[string]ActionFunc[T]),
+		guards:  make(map[string]GuardFunc[T]),
+	}
+}
+
+// RegisterAction makes an action function available under name.
+func (r *Registry[T]) RegisterAction(name string, fn ActionFunc[T]) error {
+	if _, exists := r.actions[name]; exists {
+		return &ActionError{ActionName: name, Err: ErrActionAlreadyExists}
+	}
+	if fn == nil {
+		return &ActionError{ActionName: name, Err: ErrActionNil}
+	}
+	r.actions[name] = fn
+	return nil
+}
+
+// RegisterGuard makes a guard function available under name.
+func (r *Registry[T]) RegisterGuard(name string, fn GuardFunc[T]) error {
+	if _, exists := r.guards[name]; exists {
+		return &ActionError{ActionName: name, Err: ErrGuardAlreadyExists}
+	}
+	if fn == nil {
+		return &ActionError{ActionName: name, Err: ErrActionNil}
+	}
+	r.guards[name] = fn
+	return nil
+}
+
+// Action returns the action registered under name.
+func (r *Registry[T]) Action(name string) (Action[T], bool) {
+	fn, ok := r.actions[name]
+	return Action[T]{Name: name, Fn: fn}, ok
+}
+
+// Guard returns the guard registered under name.
+func (r *Registry[T]) Guard(name string) (GuardFunc[T], bool) {
+	fn, ok := r.guards[name]
+	return fn, ok
+}
+
+// lookupAction resolves an action name. A nil registry resolves every name to an action
+// without a function, as a placeholder to be filled in later.
+func (r *Registry[T]) lookupAction(name string) (Action[T], bool) {
+	if r == nil {
+		return Action[T]{Name: name}, true
+	}
+	return r.Action(name)
+}
+
+// lookupGuard resolves a guard name. A nil registry resolves every name to a nil function,
+// which always passes.
+func (r *Registry[T]) lookupGuard(name string) (GuardFunc[T], bool) {
+	if r == nil {
+		return nil, true
+	}
+	return r.Guard(name)
+}
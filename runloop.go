@@ -0,0 +1,161 @@
+package nexus
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Future is the pending result of an event sent to a running FSM.
+type Future[T any] struct {
+	done chan struct{}
+	args *T
+	err  error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// resolve records the result and wakes up any waiters. It must be called exactly once.
+func (r *Future[T]) resolve(args *T, err error) {
+	r.args = args
+	r.err = err
+	close(r.done)
+}
+
+// Done returns a channel that is closed once the event has been processed.
+func (r *Future[T]) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait blocks until the event has been processed or ctx is done, and returns
+// what Trigger returned for it.
+func (r *Future[T]) Wait(ctx context.Context) (*T, error) {
+	select {
+	case <-r.done:
+		return r.args, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// envelope is an event waiting in the mailbox.
+type envelope[T any] struct {
+	event  Event
+	args   *T
+	future *Future[T]
+}
+
+// runLoop holds the state of the goroutine that drains the mailbox.
+// It is guarded by its own mutex so Send never waits on a running transition.
+type runLoop[T any] struct {
+	runMu   sync.Mutex
+	mailbox chan envelope[T]
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// Start launches a goroutine that processes events queued with Send, one at a time and in
+// the order they were sent. Each event runs to completion, exactly as if Trigger had been
+// called, before the next one is taken from the mailbox. The loop stops when Stop is called
+// or ctx is done; ctx is also the context passed to actions.
+//
+// Returns ErrFSMAlreadyRunning if the loop is already running.
+func (f *FSM[T]) Start(ctx context.Context) error {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	if f.mailbox != nil {
+		return ErrFSMAlreadyRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	f.mailbox = make(chan envelope[T], f.MailboxSize)
+	f.cancel = cancel
+	f.done = make(chan struct{})
+
+	go f.run(ctx, f.mailbox, f.done)
+
+	f.logger.info(ctx, "FSM started", slog.Int("mailboxSize", f.MailboxSize))
+	return nil
+}
+
+// Stop stops the run loop and waits for it to exit. The event being processed, if any, runs
+// to completion; events still in the mailbox are resolved with ErrFSMStopped.
+//
+// Returns ErrFSMStopped if the loop is not running.
+func (f *FSM[T]) Stop() error {
+	f.runMu.Lock()
+	if f.mailbox == nil {
+		f.runMu.Unlock()
+		return ErrFSMStopped
+	}
+	cancel, done := f.cancel, f.done
+	f.runMu.Unlock()
+
+	cancel()
+	<-done
+	return nil
+}
+
+// Send queues an event for the run loop and returns immediately with a Future for its result.
+//
+// Returns ErrFSMStopped if the loop is not running, and ErrMailboxFull if the mailbox has no
+// room left.
+func (f *FSM[T]) Send(event Event, args *T) (*Future[T], error) {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	if f.mailbox == nil {
+		return nil, ErrFSMStopped
+	}
+
+	future := newFuture[T]()
+	select {
+	case f.mailbox <- envelope[T]{event: event, args: args, future: future}:
+		return future, nil
+	default:
+		f.logger.warn(context.Background(), "Mailbox full, event dropped", slog.String("event", string(event)))
+		return nil, ErrMailboxFull
+	}
+}
+
+// run drains the mailbox until ctx is done.
+func (f *FSM[T]) run(ctx context.Context, mailbox chan envelope[T], done chan struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.shutdown(mailbox)
+			return
+		case env := <-mailbox:
+			if ctx.Err() != nil {
+				env.future.resolve(env.args, ErrFSMStopped)
+				f.shutdown(mailbox)
+				return
+			}
+			args, err := f.Trigger(ctx, env.event, env.args)
+			env.future.resolve(args, err)
+		}
+	}
+}
+
+// shutdown marks the loop as stopped and fails every event left in the mailbox.
+func (f *FSM[T]) shutdown(mailbox chan envelope[T]) {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	f.mailbox = nil
+	f.cancel = nil
+	for {
+		select {
+		case env := <-mailbox:
+			env.future.resolve(env.args, ErrFSMStopped)
+		default:
+			f.logger.info(context.Background(), "FSM stopped")
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package nexus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_RunLoop_ProcessesEventsInOrder(t *testing.T) {
+	fsm := New[TestData](State("a"))
+	fsm.RegisterState(State("b"))
+	fsm.RegisterState(State("c"))
+
+	increment := Action[TestData]{
+		Name: "Increment",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			args.Counter++
+			return args, nil
+		},
+	}
+	fsm.AddTransition(State("a"), State("b"), Event("next"), []Action[TestData]{increment})
+	fsm.AddTransition(State("b"), State("c"), Event("next"), []Action[TestData]{increment})
+
+	assert.NoError(t, fsm.Start(context.Background()))
+	defer fsm.Stop()
+
+	data := &TestData{}
+	first, err := fsm.Send(Event("next"), data)
+	assert.NoError(t, err)
+	second, err := fsm.Send(Event("next"), data)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = first.Wait(ctx)
+	assert.NoError(t, err)
+	result, err := second.Wait(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Counter)
+	assert.Equal(t, State("c"), fsm.GetState())
+}
+
+func TestFSM_RunLoop_Lifecycle(t *testing.T) {
+	fsm := New[TestData](State("a"))
+
+	_, err := fsm.Send(Event("next"), &TestData{})
+	assert.ErrorIs(t, err, ErrFSMStopped)
+	assert.ErrorIs(t, fsm.Stop(), ErrFSMStopped)
+
+	assert.NoError(t, fsm.Start(context.Background()))
+	assert.ErrorIs(t, fsm.Start(context.Background()), ErrFSMAlreadyRunning)
+	assert.NoError(t, fsm.Stop())
+
+	_, err = fsm.Send(Event("next"), &TestData{})
+	assert.ErrorIs(t, err, ErrFSMStopped)
+}
+
+func TestFSM_RunLoop_MailboxFull(t *testing.T) {
+	fsm := New[TestData](State("a"), WithMailboxSize(1))
+	fsm.RegisterState(State("b"))
+
+	started := make(chan struct{})
+	fsm.AddTransition(State("a"), State("b"), Event("slow"), []Action[TestData]{{
+		Name: "Block",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			close(started)
+			<-ctx.Done()
+			return args, nil
+		},
+	}})
+
+	assert.NoError(t, fsm.Start(context.Background()))
+
+	running, err := fsm.Send(Event("slow"), &TestData{})
+	assert.NoError(t, err)
+	<-started
+
+	queued, err := fsm.Send(Event("slow"), &TestData{})
+	assert.NoError(t, err)
+
+	_, err = fsm.Send(Event("slow"), &TestData{})
+	assert.ErrorIs(t, err, ErrMailboxFull)
+
+	assert.NoError(t, fsm.Stop())
+
+	_, err = running.Wait(context.Background())
+	assert.NoError(t, err)
+	_, err = queued.Wait(context.Background())
+	assert.ErrorIs(t, err, ErrFSMStopped)
+}
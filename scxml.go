@@ -0,0 +1,540 @@
+package nexus
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	scxmlNamespace = "http://www.w3.org/2005/07/scxml"
+	nexusNamespace = "https://github.com/IbrahimShahzad/nexus"
+)
+
+// WriteSCXML writes the machine definition as a W3C SCXML document.
+//
+// Nested, parallel, final and history states map to their SCXML elements, guards to cond
+// attributes and actions and hooks to <script> elements holding the action name. A state
+// timeout becomes a delayed <send> on entry with the matching <cancel> on exit. The definition
+// version and the error state are kept in attributes of the nexus namespace. States and their
+// transitions are written in registration order.
+//
+// Returns an error wrapping ErrUnsupportedConstruct for a final state with substates, which
+// SCXML cannot express.
+func (f *FSM[T]) WriteSCXML(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, state := range f.states.Keys() {
+		if f.states.IsFinal(state) && len(f.states.Children(state)) > 0 {
+			return &StateError{Op: "WriteSCXML", State: state, Err: ErrUnsupportedConstruct}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	x := &lineWriter{w: bw}
+
+	x.line(0, `<?xml version="1.0" encoding="UTF-8"?>`)
+	root := fmt.Sprintf(`<scxml xmlns="%s" xmlns:nexus="%s" version="1.0" initial=%s`,
+		scxmlNamespace, nexusNamespace, xmlAttr(string(f.initial)))
+	if f.Version != "" {
+		root += " nexus:version=" + xmlAttr(f.Version)
+	}
+	if f.errorState != "" {
+		root += " nexus:errorState=" + xmlAttr(string(f.errorState))
+	}
+	x.line(0, "%s>", root)
+	for _, state := range f.states.Keys() {
+		if f.states.Parent(state) == "" {
+			f.writeSCXMLState(x, state, 1)
+		}
+	}
+	x.line(0, "</scxml>")
+
+	if x.err != nil {
+		return x.err
+	}
+	return bw.Flush()
+}
+
+// writeSCXMLState writes a state element with its hooks, transitions and substates.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) writeSCXMLState(x *lineWriter, state State, depth int) {
+	if f.states.IsHistory(state) {
+		kind := "shallow"
+		if f.states.HistoryKind(state) == HistoryDeep {
+			kind = "deep"
+		}
+		x.line(depth, `<history id=%s type="%s"/>`, xmlAttr(string(state)), kind)
+		return
+	}
+
+	tag := "state"
+	switch {
+	case f.states.IsParallel(state):
+		tag = "parallel"
+	case f.states.IsFinal(state):
+		tag = "final"
+	}
+	children := f.states.Children(state)
+	open := fmt.Sprintf("<%s id=%s", tag, xmlAttr(string(state)))
+	if tag == "state" && len(children) > 0 {
+		open += " initial=" + xmlAttr(string(children[0]))
+	}
+
+	var transitions []*Transition[T]
+	for i := range f.transitions {
+		if f.transitions[i].From == state {
+			transitions = append(transitions, &f.transitions[i])
+		}
+	}
+	timeout, timeoutEvent, hasTimeout := f.states.timeout(state)
+	entry, exit := f.entryActions[state], f.exitActions[state]
+	histories := f.states.Histories(state)
+
+	if len(children) == 0 && len(histories) == 0 && len(transitions) == 0 && len(entry) == 0 && len(exit) == 0 && !hasTimeout {
+		x.line(depth, "%s/>", open)
+		return
+	}
+
+	x.line(depth, "%s>", open)
+	sendID := "nexus.timeout." + string(state)
+	if len(entry) > 0 || hasTimeout {
+		x.line(depth+1, "<onentry>")
+		writeSCXMLScripts(x, entry, depth+2)
+		if hasTimeout {
+			x.line(depth+2, "<send event=%s delay=%s id=%s/>", xmlAttr(string(timeoutEvent)), xmlAttr(scxmlDelay(timeout)), xmlAttr(sendID))
+		}
+		x.line(depth+1, "</onentry>")
+	}
+	if len(exit) > 0 || hasTimeout {
+		x.line(depth+1, "<onexit>")
+		writeSCXMLScripts(x, exit, depth+2)
+		if hasTimeout {
+			x.line(depth+2, "<cancel sendid=%s/>", xmlAttr(sendID))
+		}
+		x.line(depth+1, "</onexit>")
+	}
+	for _, t := range transitions {
+		attrs := fmt.Sprintf("event=%s target=%s", xmlAttr(string(t.Event)), xmlAttr(string(t.To)))
+		if t.Guard.Name != "" {
+			attrs += " cond=" + xmlAttr(t.Guard.Name)
+		}
+		if len(t.Action) == 0 {
+			x.line(depth+1, "<transition %s/>", attrs)
+			continue
+		}
+		x.line(depth+1, "<transition %s>", attrs)
+		writeSCXMLScripts(x, t.Action, depth+2)
+		x.line(depth+1, "</transition>")
+	}
+	for _, child := range children {
+		f.writeSCXMLState(x, child, depth+1)
+	}
+	for _, history := range histories {
+		f.writeSCXMLState(x, history, depth+1)
+	}
+	x.line(depth, "</%s>", tag)
+}
+
+// writeSCXMLScripts writes one <script> placeholder per action.
+func writeSCXMLScripts[T any](x *lineWriter, actions []Action[T], depth int) {
+	for _, a := range actions {
+		x.line(depth, "<script>%s</script>", xmlText(a.Name))
+	}
+}
+
+// scxmlDelay formats a duration as a CSS2 time value, as SCXML expects.
+func scxmlDelay(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func xmlAttr(s string) string {
+	return `"` + xmlText(s) + `"`
+}
+
+// scxmlNode is an element of a parsed SCXML document.
+type scxmlNode struct {
+	name     xml.Name
+	attrs    map[string]string
+	children []*scxmlNode
+	text     string
+	line     int
+	column   int
+}
+
+func (n *scxmlNode) attr(name string) string {
+	return n.attrs[name]
+}
+
+// parseSCXMLTree reads an XML document into a tree of nodes that remember their position.
+func parseSCXMLTree(r io.Reader) (*scxmlNode, error) {
+	dec := xml.NewDecoder(r)
+	var stack []*scxmlNode
+	var root *scxmlNode
+	for {
+		line, column := dec.InputPos()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line, column = dec.InputPos()
+			return nil, &LoadError{Line: line, Column: column, Err: err}
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &scxmlNode{name: t.Name, attrs: make(map[string]string), line: line, column: column}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns" || a.Name.Local == "xmlns":
+				case a.Name.Space == nexusNamespace:
+					node.attrs["nexus:"+a.Name.Local] = a.Value
+				default:
+					node.attrs[a.Name.Local] = a.Value
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, &LoadError{Err: errors.New("empty document")}
+	}
+	return root, nil
+}
+
+// scxmlParser builds an FSM from a parsed SCXML tree, collecting every problem it finds.
+type scxmlParser[T any] struct {
+	registry *Registry[T]
+	fsm      *FSM[T]
+	errs     []error
+}
+
+func (p *scxmlParser[T]) fail(n *scxmlNode, err error) {
+	p.errs = append(p.errs, &LoadError{Line: n.line, Column: n.column, Err: err})
+}
+
+func (p *scxmlParser[T]) unsupported(n *scxmlNode, what string) {
+	p.fail(n, fmt.Errorf("%w: %s", ErrUnsupportedConstruct, what))
+}
+
+func (p *scxmlParser[T]) checkAttrs(n *scxmlNode, allowed ...string) {
+	for name := range n.attrs {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || a == name
+		}
+		if !ok {
+			p.unsupported(n, fmt.Sprintf("attribute %q on <%s>", name, n.name.Local))
+		}
+	}
+}
+
+// ParseSCXML builds an FSM from a W3C SCXML document, such as one written by WriteSCXML.
+//
+// <state>, <parallel>, <final> and <history> map to nexus states, <transition> elements with a
+// single event and target to transitions, cond attributes to guard names and <script> elements
+// to action names; guards and actions are resolved against registry, or kept as named
+// placeholders if registry is nil. A delayed <send> in <onentry> with its <cancel> in <onexit>
+// becomes a state timeout.
+//
+// Anything else, such as data models, executable content other than <script>, eventless,
+// targetless or internal transitions and <invoke>, is reported as a *LoadError wrapping
+// ErrUnsupportedConstruct rather than being dropped.
+func ParseSCXML[T any](r io.Reader, registry *Registry[T], opts ...FSMOptionFunc) (*FSM[T], error) {
+	root, err := parseSCXMLTree(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &scxmlParser[T]{registry: registry}
+	if root.name.Local != "scxml" || (root.name.Space != "" && root.name.Space != scxmlNamespace) {
+		p.fail(root, fmt.Errorf("expected <scxml> root element, found <%s>", root.name.Local))
+		return nil, errors.Join(p.errs...)
+	}
+	p.checkAttrs(root, "version", "initial", "name", "datamodel", "nexus:version", "nexus:errorState")
+	if dm := root.attr("datamodel"); dm != "" && dm != "null" {
+		p.unsupported(root, fmt.Sprintf("datamodel %q", dm))
+	}
+
+	if version := root.attr("nexus:version"); version != "" {
+		opts = append([]FSMOptionFunc{WithVersion(version)}, opts...)
+	}
+
+	var states []*scxmlNode
+	for _, child := range root.children {
+		switch child.name.Local {
+		case "state", "parallel", "final":
+			states = append(states, child)
+		default:
+			p.unsupported(child, fmt.Sprintf("<%s> in <scxml>", child.name.Local))
+		}
+	}
+	if len(states) == 0 {
+		p.fail(root, errors.New("document has no states"))
+	}
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+
+	initial := State(root.attr("initial"))
+	if initial == "" {
+		initial = State(states[0].attr("id"))
+	}
+	p.fsm = newFSM[T](initial, opts)
+
+	var bodies []*scxmlNode
+	for _, st := range states {
+		bodies = p.registerState(st, "", bodies)
+	}
+	for _, st := range bodies {
+		p.stateBody(st)
+	}
+
+	if !p.fsm.states.Exists(initial) {
+		p.fail(root, &StateError{Op: "ParseSCXML", State: initial, Err: ErrStateNotRegistered})
+	}
+	if errorState := State(root.attr("nexus:errorState")); errorState != "" {
+		if p.fsm.states.Exists(errorState) {
+			p.fsm.errorState = errorState
+		} else {
+			p.fail(root, &StateError{Op: "ParseSCXML", State: errorState, Err: ErrStateNotRegistered})
+		}
+	}
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+
+	p.fsm.resetInitial()
+	return p.fsm, nil
+}
+
+// registerState registers a state element and its substates, and collects the elements whose
+// transitions and hooks are read once every state is known.
+func (p *scxmlParser[T]) registerState(n *scxmlNode, parent State, bodies []*scxmlNode) []*scxmlNode {
+	id := State(n.attr("id"))
+	if id == "" {
+		p.fail(n, fmt.Errorf("<%s> without an id", n.name.Local))
+		return bodies
+	}
+
+	var opts []StateOptionFunc
+	if parent != "" {
+		opts = append(opts, WithParent(parent))
+	}
+	switch n.name.Local {
+	case "parallel":
+		p.checkAttrs(n, "id")
+		opts = append(opts, Parallel())
+	case "final":
+		p.checkAttrs(n, "id")
+		opts = append(opts, Final())
+	case "history":
+		p.checkAttrs(n, "id", "type")
+		switch n.attr("type") {
+		case "", "shallow":
+			opts = append(opts, WithHistory(HistoryShallow))
+		case "deep":
+			opts = append(opts, WithHistory(HistoryDeep))
+		default:
+			p.fail(n, fmt.Errorf("unknown history type %q", n.attr("type")))
+		}
+		for _, child := range n.children {
+			p.unsupported(child, "default transition of <history>")
+		}
+	default:
+		p.checkAttrs(n, "id", "initial")
+	}
+	if timeout, event, ok := p.timeout(n); ok {
+		opts = append(opts, WithTimeout(timeout, event))
+	}
+
+	if err := p.fsm.RegisterState(id, opts...); err != nil {
+		p.fail(n, err)
+		return bodies
+	}
+	bodies = append(bodies, n)
+
+	var children []*scxmlNode
+	initial := n.attr("initial")
+	for _, child := range n.children {
+		switch child.name.Local {
+		case "state", "parallel", "final", "history":
+			if child.attr("id") == initial && initial != "" {
+				children = append([]*scxmlNode{child}, children...)
+			} else {
+				children = append(children, child)
+			}
+		case "initial":
+			p.unsupported(child, "<initial> element, use the initial attribute")
+		}
+	}
+	if initial != "" && (len(children) == 0 || children[0].attr("id") != initial) {
+		p.fail(n, &StateError{Op: "ParseSCXML", State: State(initial), Err: ErrStateNotRegistered})
+	}
+	for _, child := range children {
+		bodies = p.registerState(child, id, bodies)
+	}
+	return bodies
+}
+
+// timeout finds the delayed send written by WriteSCXML for a state timeout.
+func (p *scxmlParser[T]) timeout(n *scxmlNode) (time.Duration, Event, bool) {
+	send := timeoutSend(n)
+	if send == nil {
+		return 0, "", false
+	}
+	p.checkAttrs(send, "event", "delay", "id")
+	d, err := time.ParseDuration(send.attr("delay"))
+	if err != nil || send.attr("event") == "" {
+		p.unsupported(send, "<send> that is not a delayed event to the machine itself")
+		return 0, "", false
+	}
+	return d, Event(send.attr("event")), true
+}
+
+// timeoutSend returns the first <send> in the <onentry> of a state element, which is read as
+// its timeout, or nil if there is none.
+func timeoutSend(n *scxmlNode) *scxmlNode {
+	for _, child := range n.children {
+		if child.name.Local != "onentry" {
+			continue
+		}
+		for _, c := range child.children {
+			if c.name.Local == "send" {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// timeoutCancel returns the <cancel> of an <onexit> element that cancels send, or nil if there
+// is none.
+func timeoutCancel(onexit, send *scxmlNode) *scxmlNode {
+	if send == nil || send.attr("id") == "" {
+		return nil
+	}
+	for _, c := range onexit.children {
+		if c.name.Local == "cancel" && c.attr("sendid") == send.attr("id") {
+			return c
+		}
+	}
+	return nil
+}
+
+// stateBody reads the hooks and transitions of a registered state element.
+func (p *scxmlParser[T]) stateBody(n *scxmlNode) {
+	id := State(n.attr("id"))
+	send := timeoutSend(n)
+	for _, child := range n.children {
+		switch child.name.Local {
+		case "state", "parallel", "final", "history", "initial":
+		case "onentry":
+			if err := p.fsm.OnEnter(id, p.scripts(child, send)...); err != nil {
+				p.fail(child, err)
+			}
+		case "onexit":
+			if err := p.fsm.OnExit(id, p.scripts(child, timeoutCancel(child, send))...); err != nil {
+				p.fail(child, err)
+			}
+		case "transition":
+			p.transition(id, child)
+		default:
+			p.unsupported(child, fmt.Sprintf("<%s> in <%s>", child.name.Local, n.name.Local))
+		}
+	}
+}
+
+// scripts resolves the <script> placeholders of an executable content block. timer, the
+// <send> or <cancel> of the state timeout if any, is skipped.
+func (p *scxmlParser[T]) scripts(n *scxmlNode, timer *scxmlNode) []Action[T] {
+	var actions []Action[T]
+	for _, child := range n.children {
+		if child == timer {
+			continue
+		}
+		switch child.name.Local {
+		case "script":
+			if child.attr("src") != "" {
+				p.unsupported(child, "<script> with src")
+				continue
+			}
+			name := strings.TrimSpace(child.text)
+			action, ok := p.registry.lookupAction(name)
+			if !ok {
+				p.fail(child, &ActionError{ActionName: name, Err: ErrUnknownAction})
+				continue
+			}
+			actions = append(actions, action)
+		default:
+			p.unsupported(child, fmt.Sprintf("<%s> in <%s>", child.name.Local, n.name.Local))
+		}
+	}
+	return actions
+}
+
+// transition reads a transition element of the given source state.
+func (p *scxmlParser[T]) transition(from State, n *scxmlNode) {
+	p.checkAttrs(n, "event", "target", "cond", "type")
+	event, target := n.attr("event"), n.attr("target")
+	switch {
+	case n.attr("type") == "internal":
+		p.unsupported(n, "internal transition")
+		return
+	case event == "":
+		p.unsupported(n, "eventless transition")
+		return
+	case len(strings.Fields(event)) > 1:
+		p.unsupported(n, "transition on several events")
+		return
+	case target == "":
+		p.unsupported(n, "targetless transition")
+		return
+	case len(strings.Fields(target)) > 1:
+		p.unsupported(n, "transition with several targets")
+		return
+	}
+	if !p.fsm.states.Exists(State(target)) {
+		p.fail(n, &StateError{Op: "ParseSCXML", State: State(target), Err: ErrStateNotRegistered})
+		return
+	}
+
+	var opts []TransitionOptionFunc[T]
+	if cond := n.attr("cond"); cond != "" {
+		fn, ok := p.registry.lookupGuard(cond)
+		if !ok {
+			p.fail(n, &ActionError{ActionName: cond, Err: ErrUnknownGuard})
+			return
+		}
+		opts = append(opts, WithGuard(cond, fn))
+	}
+	if err := p.fsm.addTransition(from, State(target), Event(event), p.scripts(n, nil), opts...); err != nil {
+		p.fail(n, err)
+	}
+}
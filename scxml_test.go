@@ -0,0 +1,277 @@
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_WriteSCXML(t *testing.T) {
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("fulfilment")))
+	assert.NoError(t, fsm.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("packing"), WithParent(State("fulfilment"))))
+	assert.NoError(t, fsm.RegisterState(State("resume"), WithParent(State("fulfilment")), WithHistory(HistoryDeep)))
+	assert.NoError(t, fsm.RegisterState(State("tracking"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("carrier"), WithParent(State("tracking"))))
+	assert.NoError(t, fsm.RegisterState(State("in_transit"), WithParent(State("carrier"))))
+	assert.NoError(t, fsm.RegisterState(State("customer"), WithParent(State("tracking"))))
+	assert.NoError(t, fsm.RegisterState(State("unnotified"), WithParent(State("customer"))))
+	assert.NoError(t, fsm.RegisterState(State("delivered"), Final()))
+
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+	fsm.AddTransition(State("cart"), State("fulfilment"), Event("pay"),
+		[]Action[TestData]{{Name: "charge", Fn: noop}, {Name: "email", Fn: noop}},
+		WithGuard("in_stock", func(ctx context.Context, args *TestData) bool { return true }))
+	fsm.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	fsm.AddTransition(State("packing"), State("tracking"), Event("shipped"), nil)
+	fsm.AddTransition(State("tracking"), State("delivered"), Event("signed"), nil)
+
+	assert.NoError(t, fsm.RegisterState(State("awaiting_payment"), WithTimeout(15*time.Minute, Event("payment_timeout"))))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.AddTransition(State("awaiting_payment"), State("failed"), Event("payment_timeout"), nil)
+	fsm.SetErrorHandler(State("failed"), nil)
+
+	assert.NoError(t, fsm.OnEnter(State("packing"), Action[TestData]{Name: "print_label", Fn: noop}))
+	assert.NoError(t, fsm.OnExit(State("awaiting_payment"), Action[TestData]{Name: "release_hold", Fn: noop}))
+
+	var buf bytes.Buffer
+	assert.NoError(t, fsm.WriteSCXML(&buf))
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:nexus="https://github.com/IbrahimShahzad/nexus" version="1.0" initial="cart" nexus:errorState="failed">
+  <state id="cart">
+    <transition event="pay" target="fulfilment" cond="in_stock">
+      <script>charge</script>
+      <script>email</script>
+    </transition>
+  </state>
+  <state id="fulfilment" initial="picking">
+    <state id="picking">
+      <transition event="picked" target="packing"/>
+    </state>
+    <state id="packing">
+      <onentry>
+        <script>print_label</script>
+      </onentry>
+      <transition event="shipped" target="tracking"/>
+    </state>
+    <history id="resume" type="deep"/>
+  </state>
+  <parallel id="tracking">
+    <transition event="signed" target="delivered"/>
+    <state id="carrier" initial="in_transit">
+      <state id="in_transit"/>
+    </state>
+    <state id="customer" initial="unnotified">
+      <state id="unnotified"/>
+    </state>
+  </parallel>
+  <final id="delivered"/>
+  <state id="awaiting_payment">
+    <onentry>
+      <send event="payment_timeout" delay="900s" id="nexus.timeout.awaiting_payment"/>
+    </onentry>
+    <onexit>
+      <script>release_hold</script>
+      <cancel sendid="nexus.timeout.awaiting_payment"/>
+    </onexit>
+    <transition event="payment_timeout" target="failed"/>
+  </state>
+  <state id="failed"/>
+</scxml>
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestParseSCXML_RoundTrip(t *testing.T) {
+	original := New[TestData](State("cart"))
+	assert.NoError(t, original.RegisterState(State("fulfilment")))
+	assert.NoError(t, original.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, original.RegisterState(State("packing"), WithParent(State("fulfilment"))))
+	assert.NoError(t, original.RegisterState(State("resume"), WithParent(State("fulfilment")), WithHistory(HistoryDeep)))
+	assert.NoError(t, original.RegisterState(State("tracking"), Parallel()))
+	assert.NoError(t, original.RegisterState(State("carrier"), WithParent(State("tracking"))))
+	assert.NoError(t, original.RegisterState(State("in_transit"), WithParent(State("carrier"))))
+	assert.NoError(t, original.RegisterState(State("customer"), WithParent(State("tracking"))))
+	assert.NoError(t, original.RegisterState(State("unnotified"), WithParent(State("customer"))))
+	assert.NoError(t, original.RegisterState(State("delivered"), Final()))
+
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+	original.AddTransition(State("cart"), State("fulfilment"), Event("pay"),
+		[]Action[TestData]{{Name: "charge", Fn: noop}, {Name: "email", Fn: noop}},
+		WithGuard("in_stock", func(ctx context.Context, args *TestData) bool { return true }))
+	original.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	original.AddTransition(State("packing"), State("tracking"), Event("shipped"), nil)
+	original.AddTransition(State("tracking"), State("delivered"), Event("signed"), nil)
+
+	assert.NoError(t, original.RegisterState(State("awaiting_payment"), WithTimeout(15*time.Minute, Event("payment_timeout"))))
+	assert.NoError(t, original.RegisterState(State("failed")))
+	original.AddTransition(State("awaiting_payment"), State("failed"), Event("payment_timeout"), nil)
+	original.SetErrorHandler(State("failed"), nil)
+
+	assert.NoError(t, original.OnEnter(State("packing"), Action[TestData]{Name: "print_label", Fn: noop}))
+	assert.NoError(t, original.OnExit(State("awaiting_payment"), Action[TestData]{Name: "release_hold", Fn: noop}))
+
+	var buf bytes.Buffer
+	assert.NoError(t, original.WriteSCXML(&buf))
+
+	parsed, err := ParseSCXML[TestData](strings.NewReader(buf.String()), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, describeStates(original), describeStates(parsed))
+	assert.Equal(t, original.initial, parsed.initial)
+	assert.Equal(t, original.errorState, parsed.errorState)
+
+	timeout, event, ok := parsed.states.timeout(State("awaiting_payment"))
+	assert.True(t, ok)
+	assert.Equal(t, 15*time.Minute, timeout)
+	assert.Equal(t, Event("payment_timeout"), event)
+	assert.Len(t, parsed.entryActions[State("packing")], 1)
+	assert.Len(t, parsed.exitActions[State("awaiting_payment")], 1)
+
+	var again bytes.Buffer
+	assert.NoError(t, parsed.WriteSCXML(&again))
+	assert.Equal(t, buf.String(), again.String())
+}
+
+func TestParseSCXML_HandWritten(t *testing.T) {
+	doc := `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="off">
+  <state id="off">
+    <transition event="power" target="on">
+      <script>
+        boot
+      </script>
+    </transition>
+  </state>
+  <state id="on" initial="playing">
+    <state id="paused"/>
+    <state id="playing">
+      <transition event="pause" target="paused"/>
+    </state>
+    <history id="last"/>
+  </state>
+</scxml>`
+	registry := NewRegistry[TestData]()
+	registry.RegisterAction("boot", func(ctx context.Context, args *TestData) (*TestData, error) {
+		args.Counter++
+		return args, nil
+	})
+
+	fsm, err := ParseSCXML(strings.NewReader(doc), registry)
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"playing", "paused"}, fsm.states.Children(State("on")))
+	assert.Equal(t, HistoryShallow, fsm.states.HistoryKind(State("last")))
+
+	data := &TestData{}
+	_, err = fsm.Trigger(context.Background(), Event("power"), data)
+	assert.NoError(t, err)
+	assert.Equal(t, []State{"on", "playing"}, fsm.Configuration())
+	assert.Equal(t, 1, data.Counter)
+}
+
+func TestParseSCXML_InitialTimeout(t *testing.T) {
+	doc := `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="wait">
+  <state id="wait">
+    <onentry>
+      <send event="expire" delay="1s" id="nexus.timeout.wait"/>
+    </onentry>
+    <onexit>
+      <cancel sendid="nexus.timeout.wait"/>
+    </onexit>
+    <transition event="expire" target="expired"/>
+  </state>
+  <final id="expired"/>
+</scxml>`
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm, err := ParseSCXML[TestData](strings.NewReader(doc), nil, WithClock(clock))
+	assert.NoError(t, err)
+	assert.Equal(t, State("wait"), fsm.GetState())
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, State("expired"), fsm.GetState())
+}
+
+func TestParseSCXML_UnrelatedCancel(t *testing.T) {
+	doc := `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="a">
+  <state id="a">
+    <onexit>
+      <cancel sendid="other"/>
+      <script>mark</script>
+    </onexit>
+  </state>
+</scxml>`
+	_, err := ParseSCXML[TestData](strings.NewReader(doc), nil)
+	assert.ErrorIs(t, err, ErrUnsupportedConstruct)
+	assert.Contains(t, err.Error(), "<cancel> in <onexit>")
+
+	doc = `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="wait">
+  <state id="wait">
+    <onentry>
+      <send event="expire" delay="1s" id="nexus.timeout.wait"/>
+    </onentry>
+    <onexit>
+      <cancel sendid="other"/>
+      <cancel sendid="nexus.timeout.wait"/>
+    </onexit>
+    <transition event="expire" target="wait"/>
+  </state>
+</scxml>`
+	_, err = ParseSCXML[TestData](strings.NewReader(doc), nil)
+	var loadErr *LoadError
+	if assert.ErrorAs(t, err, &loadErr) {
+		assert.ErrorIs(t, err, ErrUnsupportedConstruct)
+		assert.Equal(t, 7, loadErr.Line)
+	}
+
+	doc = strings.Replace(doc, "      <cancel sendid=\"other\"/>\n", "", 1)
+	_, err = ParseSCXML[TestData](strings.NewReader(doc), nil)
+	assert.NoError(t, err)
+}
+
+func TestParseSCXML_Errors(t *testing.T) {
+	doc := `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="a">
+  <datamodel>
+    <data id="count" expr="0"/>
+  </datamodel>
+  <state id="a">
+    <transition event="go" target="b">
+      <log expr="'going'"/>
+    </transition>
+    <transition target="b"/>
+  </state>
+  <state id="b"/>
+</scxml>`
+	_, err := ParseSCXML[TestData](strings.NewReader(doc), nil)
+	assert.ErrorIs(t, err, ErrUnsupportedConstruct)
+	var loadErr *LoadError
+	assert.ErrorAs(t, err, &loadErr)
+	assert.Equal(t, 2, loadErr.Line)
+	assert.Contains(t, err.Error(), "<datamodel>")
+
+	doc = strings.Replace(doc, "  <datamodel>\n    <data id=\"count\" expr=\"0\"/>\n  </datamodel>\n", "", 1)
+	_, err = ParseSCXML[TestData](strings.NewReader(doc), nil)
+	assert.Contains(t, err.Error(), "<log> in <transition>")
+	assert.Contains(t, err.Error(), "eventless transition")
+
+	doc = `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0">
+  <state id="a">
+    <transition event="go" target="a" cond="ready"/>
+  </state>
+</scxml>`
+	_, err = ParseSCXML(strings.NewReader(doc), NewRegistry[TestData]())
+	assert.ErrorIs(t, err, ErrUnknownGuard)
+
+	_, err = ParseSCXML[TestData](strings.NewReader("<scxml><state"), nil)
+	assert.ErrorAs(t, err, &loadErr)
+}
+
+func TestFSM_WriteSCXML_FinalWithSubstates(t *testing.T) {
+	fsm := New[TestData](State("start"))
+	assert.NoError(t, fsm.RegisterState(State("done"), Final()))
+	assert.NoError(t, fsm.RegisterState(State("archived"), WithParent(State("done"))))
+	assert.ErrorIs(t, fsm.WriteSCXML(&bytes.Buffer{}), ErrUnsupportedConstruct)
+}
@@ -0,0 +1,231 @@
+package nexus
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Snapshot is a serialisable copy of the runtime state of an FSM. It holds no definition:
+// restoring it requires an FSM built with the same states and transitions.
+type Snapshot struct {
+	// Version is the definition version the FSM was configured with via WithVersion.
+	Version string `json:"version"`
+	// Active lists the active leaf states in document order.
+	Active []State `json:"active"`
+	// History maps each history pseudo-state to the states it remembers.
+	History map[State][]State `json:"history,omitempty"`
+	// Timers lists the state timeouts that were armed.
+	Timers []TimerSnapshot `json:"timers,omitempty"`
+	// TakenAt is when the snapshot was taken, according to the FSM's clock.
+	TakenAt time.Time `json:"takenAt"`
+}
+
+// TimerSnapshot is an armed state timeout inside a Snapshot.
+type TimerSnapshot struct {
+	State    State     `json:"state"`
+	Event    Event     `json:"event"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// Snapshot returns a copy of the FSM's runtime state.
+func (f *FSM[T]) Snapshot() Snapshot {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.snapshot()
+}
+
+// snapshot builds a Snapshot of the current runtime state.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) snapshot() Snapshot {
+	snap := Snapshot{
+		Version: f.Version,
+		Active:  append([]State{}, f.active...),
+		TakenAt: f.Clock.Now(),
+	}
+	if len(f.history) > 0 {
+		snap.History = make(map[State][]State, len(f.history))
+		for state, remembered := range f.history {
+			snap.History[state] = append([]State{}, remembered...)
+		}
+	}
+	for _, state := range f.states.active(f.active) {
+		if st, ok := f.timers[state]; ok {
+			snap.Timers = append(snap.Timers, TimerSnapshot{
+				State:    state,
+				Event:    st.event,
+				Deadline: st.deadline,
+			})
+		}
+	}
+	return snap
+}
+
+// Restore replaces the FSM's runtime state with a snapshot. Every state in the snapshot must be
+// registered, the active states must be a configuration the FSM can be in and the snapshot
+// version must match the FSM's. Timeouts are re-armed for the time
+// they had left; since args are not part of a snapshot, their events are triggered with a new,
+// zero T.
+//
+// Unlike SetState, no hooks run and the FSM is left untouched if the snapshot is rejected.
+func (f *FSM[T]) Restore(snap Snapshot) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkSnapshot(snap); err != nil {
+		f.logger.error(context.Background(), "Snapshot rejected", errAttr(err))
+		return err
+	}
+	f.restore(snap)
+
+	f.logger.info(context.Background(), "Snapshot restored", slog.String("state", string(f.current())), slog.String("version", snap.Version))
+	return nil
+}
+
+// checkSnapshot verifies that a snapshot fits the FSM's definition.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) checkSnapshot(snap Snapshot) error {
+	if snap.Version != f.Version {
+		return fmt.Errorf("%w: snapshot has %q, FSM has %q", ErrVersionMismatch, snap.Version, f.Version)
+	}
+	if len(snap.Active) == 0 {
+		return fmt.Errorf("%w: no active state", ErrInvalidSnapshot)
+	}
+
+	check := func(state State) error {
+		if !f.states.Exists(state) {
+			return &StateError{Op: "Restore", State: state, Err: ErrStateNotRegistered}
+		}
+		return nil
+	}
+	for _, state := range snap.Active {
+		if err := check(state); err != nil {
+			return err
+		}
+		if len(f.states.Children(state)) > 0 || f.states.IsHistory(state) {
+			return &StateError{Op: "Restore", State: state, Err: ErrInvalidState}
+		}
+	}
+	if err := f.checkConfiguration(snap.Active); err != nil {
+		return err
+	}
+	for history, remembered := range snap.History {
+		if !f.states.IsHistory(history) {
+			return &StateError{Op: "Restore", State: history, Err: ErrInvalidHistory}
+		}
+		for _, state := range remembered {
+			if err := check(state); err != nil {
+				return err
+			}
+		}
+	}
+	for _, timer := range snap.Timers {
+		if err := check(timer.State); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConfiguration verifies that a set of registered leaves can be active together: one
+// substate of every active compound state, and of the top level, and every region of every
+// active parallel state.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) checkConfiguration(leaves []State) error {
+	active := f.states.active(leaves)
+	if len(f.states.leaves(active)) != len(leaves) {
+		return fmt.Errorf("%w: a state is listed more than once", ErrInvalidSnapshot)
+	}
+	substates := make(map[State]int, len(active))
+	for _, state := range active {
+		substates[f.states.Parent(state)]++
+	}
+	if substates[""] > 1 {
+		return fmt.Errorf("%w: more than one top-level state is active", ErrInvalidSnapshot)
+	}
+	for _, state := range active {
+		n := substates[state]
+		switch {
+		case n == 0:
+		case f.states.IsParallel(state) && n < len(f.states.Children(state)):
+			return fmt.Errorf("%w: not every region of %q is active", ErrInvalidSnapshot, state)
+		case !f.states.IsParallel(state) && n > 1:
+			return fmt.Errorf("%w: more than one substate of %q is active", ErrInvalidSnapshot, state)
+		}
+	}
+	return nil
+}
+
+// restore applies a snapshot that passed checkSnapshot.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) restore(snap Snapshot) {
+	f.active = append([]State{}, snap.Active...)
+	f.started = true
+	f.states.sortDocument(f.active)
+	f.restartStateTimes()
+
+	f.history = make(map[State][]State, len(snap.History))
+	for state, remembered := range snap.History {
+		f.history[state] = append([]State{}, remembered...)
+	}
+
+	for state := range f.timers {
+		f.cancelTimer(state)
+	}
+	now := f.Clock.Now()
+	for _, timer := range snap.Timers {
+		remaining := timer.Deadline.Sub(now)
+		if remaining < 0 {
+			remaining = 0
+		}
+		f.armTimer(timer.State, remaining, timer.Event, nil)
+	}
+}
+
+// SnapshotCodec converts snapshots to and from bytes.
+type SnapshotCodec interface {
+	Marshal(snap Snapshot) ([]byte, error)
+	Unmarshal(data []byte) (Snapshot, error)
+}
+
+// JSONCodec encodes snapshots as JSON.
+type JSONCodec struct{}
+
+// Marshal encodes a snapshot as JSON.
+func (JSONCodec) Marshal(snap Snapshot) ([]byte, error) {
+	return json.Marshal(snap)
+}
+
+// Unmarshal decodes a snapshot from JSON.
+func (JSONCodec) Unmarshal(data []byte) (Snapshot, error) {
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return snap, nil
+}
+
+// GobCodec encodes snapshots with encoding/gob.
+type GobCodec struct{}
+
+// Marshal encodes a snapshot with encoding/gob.
+func (GobCodec) Marshal(snap Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a snapshot encoded with encoding/gob.
+func (GobCodec) Unmarshal(data []byte) (Snapshot, error) {
+	var snap Snapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snap); err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return snap, nil
+}
@@ -0,0 +1,110 @@
+package nexus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_SnapshotRestore(t *testing.T) {
+	// A timeout and a history state, so that a snapshot carries both.
+	def := NewDefinition[TestData](State("new"), WithVersion("v1"))
+	assert.NoError(t, def.RegisterState(State("fulfilment")))
+	assert.NoError(t, def.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+	assert.NoError(t, def.RegisterState(State("packing"), WithParent(State("fulfilment")),
+		WithTimeout(time.Hour, Event("late"))))
+	assert.NoError(t, def.RegisterState(State("fulfilment_history"), WithParent(State("fulfilment")),
+		WithHistory(HistoryShallow)))
+	assert.NoError(t, def.RegisterState(State("on_hold")))
+	assert.NoError(t, def.RegisterState(State("escalated"), Final()))
+
+	def.AddTransition(State("new"), State("fulfilment"), Event("pay"), nil)
+	def.AddTransition(State("picking"), State("packing"), Event("picked"), nil)
+	def.AddTransition(State("fulfilment"), State("on_hold"), Event("hold"), nil)
+	def.AddTransition(State("on_hold"), State("fulfilment_history"), Event("resume"), nil)
+	def.AddTransition(State("packing"), State("escalated"), Event("late"), nil)
+
+	clock := NewFakeClock(time.Unix(0, 0))
+	ctx := context.Background()
+
+	original, err := def.NewInstance("", WithClock(clock))
+	assert.NoError(t, err)
+	for _, e := range []Event{"pay", "picked", "hold", "resume"} {
+		_, err := original.Trigger(ctx, e, &TestData{})
+		assert.NoError(t, err)
+	}
+	clock.Advance(20 * time.Minute)
+	snap := original.Snapshot()
+
+	for _, codec := range []SnapshotCodec{JSONCodec{}, GobCodec{}} {
+		data, err := codec.Marshal(snap)
+		assert.NoError(t, err)
+		decoded, err := codec.Unmarshal(data)
+		assert.NoError(t, err)
+
+		clock := NewFakeClock(snap.TakenAt)
+		restored, err := def.NewInstance("", WithClock(clock))
+		assert.NoError(t, err)
+		assert.NoError(t, restored.Restore(decoded))
+		assert.NoError(t, restored.Restore(snap))
+		assert.Equal(t, State("packing"), restored.GetState())
+		assert.Equal(t, []State{"packing"}, restored.history[State("fulfilment_history")])
+
+		clock.Advance(39 * time.Minute)
+		assert.Equal(t, State("packing"), restored.GetState())
+		clock.Advance(time.Minute)
+		assert.Equal(t, State("escalated"), restored.GetState())
+	}
+}
+
+func TestFSM_Restore_Rejected(t *testing.T) {
+	fsm := New[TestData](State("new"), WithVersion("v2"))
+	assert.NoError(t, fsm.RegisterState(State("fulfilment")))
+	assert.NoError(t, fsm.RegisterState(State("picking"), WithParent(State("fulfilment"))))
+
+	err := fsm.Restore(Snapshot{Version: "v1", Active: []State{"picking"}})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	err = fsm.Restore(Snapshot{Version: "v2", Active: []State{"unknown"}})
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+
+	err = fsm.Restore(Snapshot{Version: "v2", Active: []State{"fulfilment"}})
+	assert.ErrorIs(t, err, ErrInvalidState)
+
+	err = fsm.Restore(Snapshot{Version: "v2"})
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+
+	assert.Equal(t, State("new"), fsm.GetState())
+}
+
+func TestFSM_Restore_InvalidConfiguration(t *testing.T) {
+	fsm := New[TestData](State("root"))
+	assert.NoError(t, fsm.RegisterState(State("a"), WithParent(State("root"))))
+	assert.NoError(t, fsm.RegisterState(State("b"), WithParent(State("root"))))
+	assert.NoError(t, fsm.RegisterState(State("player"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("audio"), WithParent(State("player"))))
+	assert.NoError(t, fsm.RegisterState(State("muted"), WithParent(State("audio"))))
+	assert.NoError(t, fsm.RegisterState(State("video"), WithParent(State("player"))))
+	assert.NoError(t, fsm.RegisterState(State("playing"), WithParent(State("video"))))
+
+	for _, active := range [][]State{
+		{"a", "b"},
+		{"muted"},
+		{"a", "muted", "playing"},
+		{"a", "a"},
+	} {
+		err := fsm.Restore(Snapshot{Active: active})
+		assert.ErrorIs(t, err, ErrInvalidSnapshot, "%v", active)
+	}
+	assert.Equal(t, []State{"root", "a"}, fsm.Configuration())
+
+	assert.NoError(t, fsm.Restore(Snapshot{Active: []State{"muted", "playing"}}))
+	assert.Equal(t, []State{"player", "audio", "muted", "video", "playing"}, fsm.Configuration())
+}
+
+func TestJSONCodec_InvalidData(t *testing.T) {
+	_, err := JSONCodec{}.Unmarshal([]byte("{"))
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+}
@@ -0,0 +1,451 @@
+package nexus
+
+import (
+	"sort"
+	"time"
+)
+
+// StateOptions holds configuration for a registered state.
+type StateOptions struct {
+	// Parent is the enclosing state, or empty for a top-level state.
+	Parent State
+	// Parallel makes every substate an orthogonal region that is active at
+	// the same time as its siblings.
+	Parallel bool
+	// History makes the state a history pseudo-state of its parent.
+	History HistoryType
+	// Timeout is how long the FSM may stay in the state before TimeoutEvent fires.
+	Timeout time.Duration
+	// TimeoutEvent is the event fired when Timeout expires.
+	TimeoutEvent Event
+	// Final marks a state in which the machine, or its parent, has finished.
+	Final bool
+}
+
+// HistoryType selects what a history pseudo-state remembers.
+type HistoryType int
+
+const (
+	// HistoryNone marks a regular state.
+	HistoryNone HistoryType = iota
+	// HistoryShallow remembers the direct substates of the parent that were
+	// active when it was last exited.
+	HistoryShallow
+	// HistoryDeep remembers the innermost states below the parent that were
+	// active when it was last exited.
+	HistoryDeep
+)
+
+// StateOptionFunc configures a state when it is registered.
+type StateOptionFunc func(*StateOptions)
+
+// Parallel marks a state whose substates are orthogonal regions. Entering
+// the state enters every region, and each region then follows its own
+// transitions independently.
+func Parallel() StateOptionFunc {
+	return func(opts *StateOptions) {
+		opts.Parallel = true
+	}
+}
+
+// WithHistory turns the state into a history pseudo-state of its parent.
+// A transition that targets it re-enters whatever the parent remembered
+// from the last time it was exited, or the parent's initial substate if it
+// was never exited. History states are never active themselves.
+func WithHistory(kind HistoryType) StateOptionFunc {
+	return func(opts *StateOptions) {
+		opts.History = kind
+	}
+}
+
+// WithTimeout fires event if the FSM stays in the state for longer than d.
+// The timer is armed when the state is entered and cancelled when it is left.
+func WithTimeout(d time.Duration, event Event) StateOptionFunc {
+	return func(opts *StateOptions) {
+		opts.Timeout = d
+		opts.TimeoutEvent = event
+	}
+}
+
+// Final marks the state as final: reaching it means the machine, or the parent state it is
+// nested in, is done. Final states are drawn as such in diagrams.
+func Final() StateOptionFunc {
+	return func(opts *StateOptions) {
+		opts.Final = true
+	}
+}
+
+// WithParent nests the state inside an already registered parent state.
+// The first child registered under a parent becomes its initial substate.
+func WithParent(parent State) StateOptionFunc {
+	return func(opts *StateOptions) {
+		opts.Parent = parent
+	}
+}
+
+// stateInfo is the bookkeeping kept for each registered state.
+type stateInfo struct {
+	StateOptions
+	children  []State
+	histories []State
+	index     int
+}
+
+// States manages a collection of unique states arranged as a tree.
+type States struct {
+	stateMap map[State]*stateInfo
+	order    []State
+	roots    int
+	maxSize  int
+}
+
+// NewStates creates a new States collection with maximum size.
+func NewStates(size int) *States {
+	return &States{
+		stateMap: make(map[State]*stateInfo),
+		maxSize:  size,
+	}
+}
+
+// limitReached checks if the maximum number of states has been reached.
+func (s *States) limitReached() bool {
+	return s.maxSize > 0 && len(s.stateMap) >= s.maxSize
+}
+
+// Add adds a new state to the collection.
+func (s *States) Add(state State, opts ...StateOptionFunc) error {
+	if s.Exists(state) {
+		return &StateError{
+			Op:    "Add",
+			State: state,
+			Err:   ErrStateAlreadyExists,
+		}
+	}
+
+	if s.limitReached() {
+		return &StateError{
+			Op:    "Add",
+			State: state,
+			Err:   ErrStateSizeExceeded,
+		}
+	}
+
+	info := &stateInfo{}
+	for _, opt := range opts {
+		opt(&info.StateOptions)
+	}
+
+	if info.History != HistoryNone && info.Parent == "" {
+		return &StateError{
+			Op:    "Add",
+			State: state,
+			Err:   ErrInvalidHistory,
+		}
+	}
+
+	if info.Parent != "" {
+		parent, ok := s.stateMap[info.Parent]
+		if !ok {
+			return &StateError{
+				Op:    "Add",
+				State: info.Parent,
+				Err:   ErrStateNotRegistered,
+			}
+		}
+		if parent.History != HistoryNone {
+			return &StateError{
+				Op:    "Add",
+				State: state,
+				Err:   ErrInvalidHistory,
+			}
+		}
+		if info.History != HistoryNone {
+			info.index = len(parent.histories)
+			parent.histories = append(parent.histories, state)
+		} else {
+			info.index = len(parent.children)
+			parent.children = append(parent.children, state)
+		}
+	} else {
+		info.index = s.roots
+		s.roots++
+	}
+
+	s.stateMap[state] = info
+	s.order = append(s.order, state)
+	return nil
+}
+
+// Exists checks if a state exists in the collection.
+func (s *States) Exists(state State) bool {
+	_, exists := s.stateMap[state]
+	return exists
+}
+
+// Keys returns a slice of all registered states in registration order.
+func (s *States) Keys() []State {
+	keys := make([]State, len(s.order))
+	copy(keys, s.order)
+	return keys
+}
+
+// Parent returns the parent of a state, or an empty state for top-level
+// and unknown states.
+func (s *States) Parent(state State) State {
+	if info, ok := s.stateMap[state]; ok {
+		return info.Parent
+	}
+	return ""
+}
+
+// Children returns the direct substates of a state in registration order.
+// History pseudo-states are not included.
+func (s *States) Children(state State) []State {
+	info, ok := s.stateMap[state]
+	if !ok {
+		return nil
+	}
+	children := make([]State, len(info.children))
+	copy(children, info.children)
+	return children
+}
+
+// IsDescendant reports whether state is nested, at any depth, inside ancestor.
+// A state is not considered its own descendant.
+func (s *States) IsDescendant(state, ancestor State) bool {
+	for p := s.Parent(state); p != ""; p = s.Parent(p) {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHistory reports whether a state is a history pseudo-state.
+func (s *States) IsHistory(state State) bool {
+	info, ok := s.stateMap[state]
+	return ok && info.History != HistoryNone
+}
+
+// HistoryKind returns what a history pseudo-state remembers.
+func (s *States) HistoryKind(state State) HistoryType {
+	if info, ok := s.stateMap[state]; ok {
+		return info.History
+	}
+	return HistoryNone
+}
+
+// Histories returns the history pseudo-states of a state in registration order.
+func (s *States) Histories(state State) []State {
+	info, ok := s.stateMap[state]
+	if !ok {
+		return nil
+	}
+	histories := make([]State, len(info.histories))
+	copy(histories, info.histories)
+	return histories
+}
+
+// timeout returns the timeout configured for a state, if any.
+func (s *States) timeout(state State) (time.Duration, Event, bool) {
+	info, ok := s.stateMap[state]
+	if !ok || info.TimeoutEvent == "" {
+		return 0, "", false
+	}
+	return info.Timeout, info.TimeoutEvent, true
+}
+
+// IsFinal reports whether a state is marked final.
+func (s *States) IsFinal(state State) bool {
+	info, ok := s.stateMap[state]
+	return ok && info.Final
+}
+
+// IsParallel reports whether the substates of a state are orthogonal regions.
+func (s *States) IsParallel(state State) bool {
+	info, ok := s.stateMap[state]
+	return ok && info.Parallel
+}
+
+// path returns the ancestors of a state followed by the state itself, outermost first.
+func (s *States) path(state State) []State {
+	return s.pathBetween("", state)
+}
+
+// pathBetween returns the states strictly below ancestor down to and
+// including descendant, outermost first.
+func (s *States) pathBetween(ancestor, descendant State) []State {
+	var path []State
+	for st := descendant; st != "" && st != ancestor; st = s.Parent(st) {
+		path = append(path, st)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// before reports whether a comes before b in document order, that is in a
+// pre-order walk of the state tree visiting siblings in registration order.
+func (s *States) before(a, b State) bool {
+	pa, pb := s.path(a), s.path(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] != pb[i] {
+			return s.index(pa[i]) < s.index(pb[i])
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// index returns the position of a state among its siblings, or -1 if it is unknown.
+func (s *States) index(state State) int {
+	if info, ok := s.stateMap[state]; ok {
+		return info.index
+	}
+	return -1
+}
+
+// sortDocument sorts states in document order.
+func (s *States) sortDocument(states []State) {
+	sort.SliceStable(states, func(i, j int) bool {
+		return s.before(states[i], states[j])
+	})
+}
+
+// defaultEntry returns the substates entered, outermost first, when state is
+// entered without an explicit target inside it: the initial substate of a
+// compound state, or every region of a parallel state.
+func (s *States) defaultEntry(state State) []State {
+	info, ok := s.stateMap[state]
+	if !ok || len(info.children) == 0 {
+		return nil
+	}
+	var entered []State
+	children := info.children[:1]
+	if info.Parallel {
+		children = info.children
+	}
+	for _, child := range children {
+		entered = append(entered, child)
+		entered = append(entered, s.defaultEntry(child)...)
+	}
+	return entered
+}
+
+// defaultLeaves returns the leaves that become active when state is entered
+// without an explicit target inside it.
+func (s *States) defaultLeaves(state State) []State {
+	return s.leaves(append([]State{state}, s.defaultEntry(state)...))
+}
+
+// leaves filters a set of states down to those without substates.
+func (s *States) leaves(states []State) []State {
+	var leaves []State
+	for _, st := range states {
+		if info, ok := s.stateMap[st]; !ok || len(info.children) == 0 {
+			leaves = append(leaves, st)
+		}
+	}
+	return leaves
+}
+
+// domain returns the innermost compound (non-parallel) state that properly
+// contains both the source and the target of a transition, or an empty state
+// if only the root does.
+func (s *States) domain(source, target State) State {
+	for p := s.Parent(source); p != ""; p = s.Parent(p) {
+		if s.IsParallel(p) {
+			continue
+		}
+		if target == p || s.IsDescendant(target, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// active expands a set of active leaves into the full set of active states,
+// in document order.
+func (s *States) active(leaves []State) []State {
+	seen := make(map[State]struct{})
+	var states []State
+	for _, leaf := range leaves {
+		for _, st := range s.path(leaf) {
+			if _, ok := seen[st]; ok {
+				continue
+			}
+			seen[st] = struct{}{}
+			states = append(states, st)
+		}
+	}
+	s.sortDocument(states)
+	return states
+}
+
+// exitSet returns the active states left by a transition with the given
+// domain, in document order.
+func (s *States) exitSet(leaves []State, domain State) []State {
+	var exited []State
+	for _, st := range s.active(leaves) {
+		if domain == "" || s.IsDescendant(st, domain) {
+			exited = append(exited, st)
+		}
+	}
+	return exited
+}
+
+// entrySet returns the states entered by a transition with the given domain
+// that ends in the given target states, in document order. Regions of any
+// parallel state on the way to the targets are entered as well.
+func (s *States) entrySet(domain State, targets []State) []State {
+	onPath := make(map[State]struct{})
+	var entered []State
+	for _, target := range targets {
+		for _, st := range s.pathBetween(domain, target) {
+			if _, ok := onPath[st]; ok {
+				continue
+			}
+			onPath[st] = struct{}{}
+			entered = append(entered, st)
+		}
+	}
+
+	for _, st := range append([]State{}, entered...) {
+		if !s.IsParallel(st) {
+			continue
+		}
+		for _, region := range s.stateMap[st].children {
+			if _, ok := onPath[region]; ok {
+				continue
+			}
+			entered = append(entered, region)
+			entered = append(entered, s.defaultEntry(region)...)
+		}
+	}
+	for _, target := range targets {
+		entered = append(entered, s.defaultEntry(target)...)
+	}
+	s.sortDocument(entered)
+	return entered
+}
+
+// commonAncestor returns the innermost state that is, or contains, every one
+// of the given states.
+func (s *States) commonAncestor(states []State) State {
+	if len(states) == 0 {
+		return ""
+	}
+	common := s.path(states[0])
+	for _, st := range states[1:] {
+		p := s.path(st)
+		n := 0
+		for n < len(common) && n < len(p) && common[n] == p[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 0 {
+		return ""
+	}
+	return common[len(common)-1]
+}
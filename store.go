@@ -0,0 +1,303 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Record is a snapshot kept in a Store together with its version.
+type Record struct {
+	Snapshot Snapshot `json:"snapshot"`
+	// Version starts at 1 and grows by one on every successful Save.
+	Version uint64 `json:"version"`
+}
+
+// Store persists snapshots of FSM instances keyed by ID.
+//
+// Writes use optimistic concurrency: Save and Delete take the version the caller last saw,
+// 0 meaning the record must not exist yet, and fail with ErrVersionConflict if the stored
+// version differs.
+type Store interface {
+	// Load returns the record stored under id, or ErrRecordNotFound.
+	Load(ctx context.Context, id string) (Record, error)
+	// Save stores a snapshot under id and returns its new version.
+	Save(ctx context.Context, id string, snap Snapshot, expected uint64) (uint64, error)
+	// Delete removes the record stored under id.
+	Delete(ctx context.Context, id string, expected uint64) error
+}
+
+// Bind attaches the FSM to a record in a store. If the record exists its snapshot is restored,
+// otherwise the current state is saved as a new record. From then on the new state is saved
+// after every Trigger that changes it; if saving fails the FSM is rolled back to the state it
+// had before the Trigger and the error is returned.
+//
+// While bound, journal entries, transition counts and the notifications sent after a
+// transition are held back until the state is saved. If saving fails, the journal entries are
+// dropped and the transitions are reported as failed with the store error.
+func (f *FSM[T]) Bind(ctx context.Context, store Store, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record, err := store.Load(ctx, id)
+	switch {
+	case err == nil:
+		if err := f.checkSnapshot(record.Snapshot); err != nil {
+			return &StoreError{Op: "Bind", ID: id, Err: err}
+		}
+		f.restore(record.Snapshot)
+	case errors.Is(err, ErrRecordNotFound):
+		if record.Version, err = store.Save(ctx, id, f.snapshot(), 0); err != nil {
+			return &StoreError{Op: "Bind", ID: id, Err: err}
+		}
+	default:
+		return &StoreError{Op: "Bind", ID: id, Err: err}
+	}
+
+	f.store = store
+	f.storeID = id
+	f.storeVersion = record.Version
+
+	f.logger.info(ctx, "FSM bound to store", slog.String("id", id), slog.Uint64("version", record.Version), slog.String("state", string(f.current())))
+	return nil
+}
+
+// binding is the store an FSM saves itself to.
+type binding struct {
+	store        Store
+	storeID      string
+	storeVersion uint64
+	unsaved      *unsaved // held back by the Trigger being processed
+}
+
+// unsaved is what a Trigger publishes once the state it led to is saved.
+type unsaved struct {
+	entries       []JournalEntry
+	counts        []transitionCount
+	notifications []Notification
+}
+
+// transitionCount is a transition waiting to be counted.
+type transitionCount struct {
+	from, to State
+	event    Event
+	outcome  Outcome
+}
+
+// publish sends what a Trigger held back. saveErr is the error saving its state failed with,
+// if it did.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) publish(ctx context.Context, held *unsaved, saveErr error) {
+	for _, c := range held.counts {
+		if saveErr != nil {
+			c.outcome = OutcomeFailed
+		}
+		f.countTransition(c.from, c.to, c.event, c.outcome)
+	}
+	for _, n := range held.notifications {
+		if saveErr != nil && n.Kind == AfterTransition {
+			n.Kind, n.Err = TransitionFailed, saveErr
+		}
+		f.notify(n)
+	}
+	if saveErr != nil {
+		return
+	}
+	for _, entry := range held.entries {
+		f.appendEntry(ctx, entry)
+	}
+}
+
+// persist saves the current state to the bound store, if any.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) persist(ctx context.Context) error {
+	version, err := f.store.Save(ctx, f.storeID, f.snapshot(), f.storeVersion)
+	if err != nil {
+		f.logger.error(ctx, "Failed to persist state", errAttr(err), slog.String("id", f.storeID), slog.Uint64("version", f.storeVersion))
+		return &StoreError{Op: "Save", ID: f.storeID, Err: err}
+	}
+	f.storeVersion = version
+	return nil
+}
+
+// MemoryStore is a Store that keeps records in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Load returns the record stored under id.
+func (s *MemoryStore) Load(ctx context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrRecordNotFound
+	}
+	return record, nil
+}
+
+// Save stores a snapshot under id if its version is still expected.
+func (s *MemoryStore) Save(ctx context.Context, id string, snap Snapshot, expected uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records[id].Version != expected {
+		return 0, ErrVersionConflict
+	}
+	record := Record{Snapshot: snap, Version: expected + 1}
+	s.records[id] = record
+	return record.Version, nil
+}
+
+// Delete removes the record stored under id if its version is still expected.
+func (s *MemoryStore) Delete(ctx context.Context, id string, expected uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	if record.Version != expected {
+		return ErrVersionConflict
+	}
+	delete(s.records, id)
+	return nil
+}
+
+// FileStore is a Store that keeps one JSON file per record in a directory.
+//
+// Every write goes to a temporary file that is synced and then renamed over the record, so a
+// crash leaves either the old or the new version on disk, never a partial one. Version checks
+// are serialised within the process only; a directory must not be shared by several processes.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore creates a FileStore in dir, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the file a record is stored in. IDs are escaped so any string is a valid ID.
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+// Load returns the record stored under id.
+func (s *FileStore) Load(ctx context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+// load reads a record from disk.
+// NOTE: Should be called with the lock
+func (s *FileStore) load(id string) (Record, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Record{}, ErrRecordNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return Record{}, &StoreError{Op: "Load", ID: id, Err: ErrInvalidSnapshot}
+	}
+	return record, nil
+}
+
+// Save writes a snapshot under id if its version is still expected.
+func (s *FileStore) Save(ctx context.Context, id string, snap Snapshot, expected uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.load(id)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		return 0, err
+	}
+	if current.Version != expected {
+		return 0, ErrVersionConflict
+	}
+
+	record := Record{Snapshot: snap, Version: expected + 1}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.writeAtomic(s.path(id), data); err != nil {
+		return 0, err
+	}
+	return record.Version, nil
+}
+
+// Delete removes the record stored under id if its version is still expected.
+func (s *FileStore) Delete(ctx context.Context, id string, expected uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	if current.Version != expected {
+		return ErrVersionConflict
+	}
+	if err := os.Remove(s.path(id)); err != nil {
+		return err
+	}
+	return s.syncDir()
+}
+
+// writeAtomic replaces path with data through a synced temporary file and a rename.
+func (s *FileStore) writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return s.syncDir()
+}
+
+// syncDir flushes the directory entry changes made by a rename or remove.
+func (s *FileStore) syncDir() error {
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
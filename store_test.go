@@ -0,0 +1,160 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	snap := Snapshot{Version: "v1", Active: []State{"a"}, TakenAt: time.Unix(10, 0).UTC()}
+
+	_, err := store.Load(ctx, "order/1")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+
+	version, err := store.Save(ctx, "order/1", snap, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), version)
+
+	_, err = store.Save(ctx, "order/1", snap, 0)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	snap.Active = []State{"b"}
+	version, err = store.Save(ctx, "order/1", snap, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), version)
+
+	record, err := store.Load(ctx, "order/1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), record.Version)
+	assert.Equal(t, snap, record.Snapshot)
+
+	assert.ErrorIs(t, store.Delete(ctx, "order/1", 1), ErrVersionConflict)
+	assert.NoError(t, store.Delete(ctx, "order/1", 2))
+	_, err = store.Load(ctx, "order/1")
+	assert.ErrorIs(t, err, ErrRecordNotFound)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+	testStore(t, store)
+}
+
+func TestFSM_Bind_PersistsTransitions(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+
+	build := func() *FSM[TestData] {
+		fsm := New[TestData](State("new"), WithVersion("v1"))
+		fsm.RegisterState(State("paid"))
+		fsm.RegisterState(State("shipped"))
+		fsm.AddTransition(State("new"), State("paid"), Event("pay"), nil)
+		fsm.AddTransition(State("paid"), State("shipped"), Event("ship"), nil)
+		return fsm
+	}
+
+	fsm := build()
+	assert.NoError(t, fsm.Bind(ctx, store, "order-1"))
+	_, err = fsm.Trigger(ctx, Event("pay"), &TestData{})
+	assert.NoError(t, err)
+
+	reloaded := build()
+	assert.NoError(t, reloaded.Bind(ctx, store, "order-1"))
+	assert.Equal(t, State("paid"), reloaded.GetState())
+
+	record, err := store.Load(ctx, "order-1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), record.Version)
+}
+
+// failingStore is a Store whose Save fails once armed.
+type failingStore struct {
+	*MemoryStore
+	fail bool
+}
+
+func (s *failingStore) Save(ctx context.Context, id string, snap Snapshot, expected uint64) (uint64, error) {
+	if s.fail {
+		return 0, errors.New("disk full")
+	}
+	return s.MemoryStore.Save(ctx, id, snap, expected)
+}
+
+func TestFSM_Bind_RollsBackOnSaveFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+
+	fsm := New[TestData](State("new"))
+	fsm.RegisterState(State("paid"))
+	fsm.AddTransition(State("new"), State("paid"), Event("pay"), nil)
+	assert.NoError(t, fsm.Bind(ctx, store, "order-1"))
+
+	store.fail = true
+	_, err := fsm.Trigger(ctx, Event("pay"), &TestData{})
+
+	var storeErr *StoreError
+	assert.ErrorAs(t, err, &storeErr)
+	assert.Equal(t, "order-1", storeErr.ID)
+	assert.Equal(t, State("new"), fsm.GetState())
+}
+
+func TestFSM_Bind_SaveFailureIsNotPublished(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	journal := NewMemoryJournal()
+	metrics := NewMetrics("orders")
+
+	fsm := New[TestData](State("a"), WithJournal(journal), WithMetrics(metrics))
+	fsm.RegisterState(State("b"))
+	fsm.AddTransition(State("a"), State("b"), Event("go"), nil)
+	fsm.AddTransition(State("b"), State("a"), Event("back"), nil)
+	assert.NoError(t, fsm.Bind(ctx, store, "order-1"))
+
+	var kinds []NotificationKind
+	var errs []error
+	fsm.Observe(func(n Notification) {
+		kinds = append(kinds, n.Kind)
+		errs = append(errs, n.Err)
+	})
+
+	store.fail = true
+	_, err := fsm.Trigger(ctx, Event("go"), &TestData{})
+	var storeErr *StoreError
+	assert.ErrorAs(t, err, &storeErr)
+	assert.Equal(t, State("a"), fsm.GetState())
+
+	entries, err := journal.Entries(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Equal(t, []NotificationKind{BeforeTransition, TransitionFailed}, kinds)
+	assert.ErrorAs(t, errs[1], &storeErr)
+	assert.Equal(t, []TransitionCount{{From: "a", To: "b", Event: "go", Outcome: OutcomeFailed, Count: 1}},
+		metrics.Snapshot().Transitions)
+
+	store.fail = false
+	_, err = fsm.Trigger(ctx, Event("go"), &TestData{})
+	assert.NoError(t, err)
+	entries, err = journal.Entries(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []State{"b"}, entries[0].To)
+	assert.Equal(t, AfterTransition, kinds[len(kinds)-1])
+
+	// The journal replays to the saved state.
+	replayed := New[TestData](State("a"))
+	replayed.RegisterState(State("b"))
+	replayed.AddTransition(State("a"), State("b"), Event("go"), nil)
+	_, err = replayed.Replay(ctx, entries, ReplaySkipActions)
+	assert.NoError(t, err)
+	assert.Equal(t, fsm.Configuration(), replayed.Configuration())
+}
@@ -0,0 +1,102 @@
+package nexus
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// stateTimer is an armed timeout for an active state.
+type stateTimer[T any] struct {
+	timer    Timer
+	deadline time.Time
+	event    Event
+	args     *T
+}
+
+// updateTimers cancels the timeouts of exited states and arms those of entered states.
+// The args are what the timeout event will be triggered with; nil triggers it with a zero T.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) updateTimers(exited, entered []State, args *T) {
+	for _, state := range exited {
+		f.cancelTimer(state)
+	}
+	for _, state := range entered {
+		if d, event, ok := f.states.timeout(state); ok {
+			f.armTimer(state, d, event, args)
+		}
+	}
+}
+
+// resetTimers cancels every timeout and arms those of the current configuration, for when the
+// configuration changes without a transition.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) resetTimers(args *T) {
+	f.stopTimers()
+	for _, state := range f.states.active(f.active) {
+		if d, event, ok := f.states.timeout(state); ok {
+			f.armTimer(state, d, event, args)
+		}
+	}
+}
+
+// stopTimers cancels every timeout.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) stopTimers() {
+	for state := range f.timers {
+		f.cancelTimer(state)
+	}
+}
+
+// armTimer schedules event to fire after d unless state is left first.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) armTimer(state State, d time.Duration, event Event, args *T) {
+	f.cancelTimer(state)
+
+	st := &stateTimer[T]{
+		deadline: f.Clock.Now().Add(d),
+		event:    event,
+		args:     args,
+	}
+	st.timer = f.Clock.AfterFunc(d, func() {
+		f.fireTimer(state, st)
+	})
+	f.timers[state] = st
+
+	f.logger.debug(context.Background(), "State timeout armed", slog.String("state", string(state)), slog.String("event", string(event)), slog.Duration("timeout", d))
+}
+
+// cancelTimer stops the timeout of a state, if one is armed.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) cancelTimer(state State) {
+	st, ok := f.timers[state]
+	if !ok {
+		return
+	}
+	st.timer.Stop()
+	delete(f.timers, state)
+}
+
+// fireTimer triggers the timeout event of a state, unless the timer was cancelled or
+// replaced in the meantime.
+func (f *FSM[T]) fireTimer(state State, st *stateTimer[T]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.timers[state] != st {
+		return
+	}
+	delete(f.timers, state)
+
+	ctx := context.Background()
+	f.logger.info(ctx, "State timeout expired", slog.String("state", string(state)), slog.String("event", string(st.event)))
+
+	args := st.args
+	if args == nil {
+		// Armed without a Trigger: on entering the initial state, on SetState or on Restore.
+		args = new(T)
+	}
+	if _, err := f.dispatch(ctx, st.event, args); err != nil {
+		f.logger.error(ctx, "State timeout event failed", errAttr(err), slog.String("state", string(state)), slog.String("event", string(st.event)))
+	}
+}
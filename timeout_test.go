@@ -0,0 +1,100 @@
+package nexus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_Timeout_FiresEvent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("cart"), WithClock(clock))
+	fsm.RegisterState(State("awaiting_payment"), WithTimeout(15*time.Minute, Event("payment_timeout")))
+	fsm.RegisterState(State("expired"))
+
+	fsm.AddTransition(State("cart"), State("awaiting_payment"), Event("checkout"), nil)
+	fsm.AddTransition(State("awaiting_payment"), State("expired"), Event("payment_timeout"), []Action[TestData]{{
+		Name: "MarkExpired",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			args.Value = "expired"
+			return args, nil
+		},
+	}})
+
+	data := &TestData{}
+	_, err := fsm.Trigger(context.Background(), Event("checkout"), data)
+	assert.NoError(t, err)
+
+	clock.Advance(14 * time.Minute)
+	assert.Equal(t, State("awaiting_payment"), fsm.GetState())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, State("expired"), fsm.GetState())
+	assert.Equal(t, "expired", data.Value)
+}
+
+func TestFSM_Timeout_CancelledOnExit(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("cart"), WithClock(clock))
+	fsm.RegisterState(State("awaiting_payment"), WithTimeout(15*time.Minute, Event("payment_timeout")))
+	fsm.RegisterState(State("paid"))
+	fsm.RegisterState(State("expired"))
+
+	fsm.AddTransition(State("cart"), State("awaiting_payment"), Event("checkout"), nil)
+	fsm.AddTransition(State("awaiting_payment"), State("paid"), Event("pay"), nil)
+	fsm.AddTransition(State("awaiting_payment"), State("expired"), Event("payment_timeout"), nil)
+	fsm.AddTransition(State("paid"), State("expired"), Event("payment_timeout"), nil)
+
+	ctx := context.Background()
+	fsm.Trigger(ctx, Event("checkout"), &TestData{})
+	fsm.Trigger(ctx, Event("pay"), &TestData{})
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, State("paid"), fsm.GetState())
+}
+
+func TestFSM_Timeout_RearmedOnReentry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("idle"), WithClock(clock))
+	fsm.RegisterState(State("waiting"), WithTimeout(10*time.Second, Event("timeout")))
+
+	fsm.AddTransition(State("idle"), State("waiting"), Event("wait"), nil)
+	fsm.AddTransition(State("waiting"), State("waiting"), Event("poke"), nil)
+	fsm.AddTransition(State("waiting"), State("idle"), Event("timeout"), nil)
+
+	ctx := context.Background()
+	fsm.Trigger(ctx, Event("wait"), &TestData{})
+	clock.Advance(8 * time.Second)
+	fsm.Trigger(ctx, Event("poke"), &TestData{})
+
+	clock.Advance(8 * time.Second)
+	assert.Equal(t, State("waiting"), fsm.GetState())
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, State("idle"), fsm.GetState())
+}
+
+func TestFSM_Timeout_ArmedWithoutTrigger(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fsm := New[TestData](State("session"), WithClock(clock))
+	assert.NoError(t, fsm.RegisterState(State("idle"), WithParent(State("session")),
+		WithTimeout(time.Minute, Event("timeout"))))
+	assert.NoError(t, fsm.RegisterState(State("closed")))
+	fsm.AddTransition(State("idle"), State("closed"), Event("timeout"), []Action[TestData]{{
+		Name: "MarkClosed",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			args.Value = "closed"
+			return args, nil
+		},
+	}})
+	snap := fsm.Snapshot()
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, State("closed"), fsm.GetState())
+
+	assert.NoError(t, fsm.Restore(snap))
+	clock.Advance(time.Minute)
+	assert.Equal(t, State("closed"), fsm.GetState())
+}
@@ -0,0 +1,202 @@
+package nexus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Tracer starts spans. It is shaped after OpenTelemetry so that an adapter to an
+// OpenTelemetry tracer is a few lines long; SpanRecorder is an in-memory implementation for
+// tests.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if any, and returns a context
+	// carrying the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key and value attached to a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Span names and attribute keys used by the FSM.
+const (
+	SpanTrigger = "nexus.trigger"
+	SpanAction  = "nexus.action"
+
+	AttrInstance   = "nexus.instance"
+	AttrEvent      = "nexus.event"
+	AttrFrom       = "nexus.state.from"
+	AttrTo         = "nexus.state.to"
+	AttrOutcome    = "nexus.outcome"
+	AttrState      = "nexus.state"
+	AttrAction     = "nexus.action"
+	AttrActionKind = "nexus.action.kind"
+)
+
+// WithTracer traces the FSM with t: every Trigger, every event sent with Send and every
+// timeout gets a span, and every action and hook run for it a child span. The context passed
+// to actions carries the action span, so spans started by actions nest below it. Nothing is
+// traced while replaying a journal.
+func WithTracer(t Tracer) FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Tracer = t
+	}
+}
+
+func noEnd(error) {}
+
+// traceTrigger starts the span of a triggered event. The returned function ends it.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) traceTrigger(ctx context.Context, event Event) (context.Context, func(error)) {
+	if f.Tracer == nil || f.replay != nil {
+		return ctx, noEnd
+	}
+
+	attrs := []Attribute{{AttrEvent, string(event)}, {AttrFrom, string(f.current())}}
+	if f.id != "" {
+		attrs = append(attrs, Attribute{AttrInstance, f.id})
+	}
+	ctx, span := f.Tracer.Start(ctx, SpanTrigger, attrs...)
+	return ctx, func(err error) {
+		span.SetAttributes(Attribute{AttrTo, string(f.current())}, Attribute{AttrOutcome, string(outcomeOf(err))})
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
+
+// traceAction starts the span of an action. The returned function ends it.
+// NOTE: Should be called with the lock
+func (f *FSM[T]) traceAction(ctx context.Context, info ActionInfo) (context.Context, func(error)) {
+	if f.Tracer == nil {
+		return ctx, noEnd
+	}
+
+	ctx, span := f.Tracer.Start(ctx, SpanAction,
+		Attribute{AttrAction, info.Action},
+		Attribute{AttrActionKind, info.Kind.String()},
+		Attribute{AttrState, string(info.State)},
+		Attribute{AttrEvent, string(info.Event)},
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
+
+// SpanRecorder is a Tracer that keeps every span in memory, for tests.
+type SpanRecorder struct {
+	mu     sync.Mutex
+	nextID int
+	spans  []*RecordedSpan
+}
+
+// RecordedSpan is a span kept by a SpanRecorder.
+type RecordedSpan struct {
+	ID int
+	// ParentID is the ID of the parent span, or 0 for a root span.
+	ParentID   int
+	Name       string
+	Attributes []Attribute
+	Errors     []error
+	Start      time.Time
+	End        time.Time
+	Ended      bool
+}
+
+// Attribute returns the last value set for key.
+func (s RecordedSpan) Attribute(key string) (string, bool) {
+	for i := len(s.Attributes) - 1; i >= 0; i-- {
+		if s.Attributes[i].Key == key {
+			return s.Attributes[i].Value, true
+		}
+	}
+	return "", false
+}
+
+type recordedSpanKey struct{}
+
+// NewSpanRecorder creates an empty SpanRecorder.
+func NewSpanRecorder() *SpanRecorder {
+	return &SpanRecorder{}
+}
+
+// Start implements Tracer.
+func (r *SpanRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	span := &RecordedSpan{
+		ID:         r.nextID,
+		Name:       name,
+		Attributes: append([]Attribute{}, attrs...),
+		Start:      time.Now(),
+	}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok {
+		span.ParentID = parent.ID
+	}
+	r.spans = append(r.spans, span)
+	return context.WithValue(ctx, recordedSpanKey{}, span), &recorderSpan{r: r, span: span}
+}
+
+// Spans returns a copy of every span started so far, in start order.
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+		spans[i].Attributes = append([]Attribute{}, s.Attributes...)
+		spans[i].Errors = append([]error{}, s.Errors...)
+	}
+	return spans
+}
+
+// Reset forgets every span.
+func (r *SpanRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+// recorderSpan is the Span handed out by a SpanRecorder.
+type recorderSpan struct {
+	r    *SpanRecorder
+	span *RecordedSpan
+}
+
+func (s *recorderSpan) SetAttributes(attrs ...Attribute) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.span.Attributes = append(s.span.Attributes, attrs...)
+}
+
+func (s *recorderSpan) RecordError(err error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.span.Errors = append(s.span.Errors, err)
+}
+
+func (s *recorderSpan) End() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	if !s.span.Ended {
+		s.span.End = time.Now()
+		s.span.Ended = true
+	}
+}
@@ -0,0 +1,81 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_Tracing(t *testing.T) {
+	tracer := NewSpanRecorder()
+	fsm := New[TestData](State("cart"), WithTracer(tracer))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.OnEnter(State("paid"), Action[TestData]{
+		Name: "receipt",
+		Fn: func(ctx context.Context, args *TestData) (*TestData, error) {
+			// Spans started by actions nest below the action span.
+			_, span := tracer.Start(ctx, "smtp.send")
+			span.End()
+			return args, nil
+		},
+	}))
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn:   func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil },
+	}})
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.NoError(t, err)
+
+	spans := tracer.Spans()
+	assert.Len(t, spans, 4)
+	trigger, charge, receipt, smtp := spans[0], spans[1], spans[2], spans[3]
+
+	assert.Equal(t, SpanTrigger, trigger.Name)
+	assert.Zero(t, trigger.ParentID)
+	for key, want := range map[string]string{AttrEvent: "pay", AttrFrom: "cart", AttrTo: "paid", AttrOutcome: "ok"} {
+		got, _ := trigger.Attribute(key)
+		assert.Equal(t, want, got, key)
+	}
+
+	assert.Equal(t, SpanAction, charge.Name)
+	assert.Equal(t, trigger.ID, charge.ParentID)
+	name, _ := charge.Attribute(AttrAction)
+	assert.Equal(t, "charge", name)
+	kind, _ := receipt.Attribute(AttrActionKind)
+	assert.Equal(t, "entry", kind)
+	assert.Equal(t, trigger.ID, receipt.ParentID)
+	assert.Equal(t, receipt.ID, smtp.ParentID)
+
+	for _, span := range spans {
+		assert.True(t, span.Ended, span.Name)
+		assert.Empty(t, span.Errors)
+	}
+}
+
+func TestFSM_Tracing_RecordsErrors(t *testing.T) {
+	tracer := NewSpanRecorder()
+	errDeclined := errors.New("card declined")
+	fsm := New[TestData](State("cart"), WithTracer(tracer))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{
+		Name: "charge",
+		Fn:   func(ctx context.Context, args *TestData) (*TestData, error) { return args, errDeclined },
+	}})
+
+	_, err := fsm.Trigger(context.Background(), Event("pay"), &TestData{})
+	assert.ErrorIs(t, err, errDeclined)
+	_, err = fsm.Trigger(context.Background(), Event("ship"), &TestData{})
+	assert.ErrorIs(t, err, ErrNoTransition)
+
+	spans := tracer.Spans()
+	assert.Len(t, spans, 3)
+	assert.Equal(t, []error{errDeclined}, spans[1].Errors)
+	assert.Len(t, spans[0].Errors, 1)
+	outcome, _ := spans[0].Attribute(AttrOutcome)
+	assert.Equal(t, string(OutcomeFailed), outcome)
+	outcome, _ = spans[2].Attribute(AttrOutcome)
+	assert.Equal(t, string(OutcomeNoTransition), outcome)
+}
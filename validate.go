@@ -0,0 +1,175 @@
+package nexus
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// WithStrict makes registration stricter: AddTransition leaves out transitions between
+// unregistered states, actions without a function and duplicate transitions, reporting them
+// from Validate, and OnEnter and OnExit reject actions without a function. Problems that
+// depend on the whole definition, such as unreachable states, are only reported by Validate.
+func WithStrict() FSMOptionFunc {
+	return func(opts *FSMOptions) {
+		opts.Strict = true
+	}
+}
+
+// Validate checks the machine definition and reports every problem it finds, joined into a
+// single error; use errors.Is to test for a kind of problem. It returns nil for a sound
+// definition.
+//
+// It reports transitions from or to unregistered states (ErrStateNotRegistered), actions and
+// hooks without a function (ErrActionNil), transitions that can never be taken because an
+// earlier one has the same state, event and guard name, or no guard function at all
+// (ErrTransitionAlreadyExists), states that cannot be reached from the initial state
+// (ErrUnreachableState) and states without outgoing transitions that are not final
+// (ErrDeadEndState). The error state is expected to be a sink and is not reported as a dead
+// end; history states are not checked for reachability. Transitions and error handlers that
+// AddTransition and SetErrorHandler left out are reported with the reason they were.
+func (d *Definition[T]) Validate() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	problems := slices.Clone(d.rejected)
+	for i := range d.transitions {
+		t := &d.transitions[i]
+		earlier := d.candidates(t.From, t.Event)
+		problems = append(problems, d.checkTransition(t, earlier[:slices.Index(earlier, i)])...)
+	}
+	for _, state := range d.states.Keys() {
+		problems = append(problems, checkActions(d.entryActions[state], state, "")...)
+		problems = append(problems, checkActions(d.exitActions[state], state, "")...)
+	}
+
+	reachable := d.reachable()
+	for _, state := range d.states.Keys() {
+		if d.states.IsHistory(state) {
+			continue
+		}
+		if _, ok := reachable[state]; !ok {
+			problems = append(problems, &StateError{Op: "Validate", State: state, Err: ErrUnreachableState})
+		}
+		if d.isDeadEnd(state) {
+			problems = append(problems, &StateError{Op: "Validate", State: state, Err: ErrDeadEndState})
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// checkTransition reports the problems of a transition registered after the transitions at the
+// earlier positions, which share its state and event.
+// NOTE: Should be called with the lock
+func (d *Definition[T]) checkTransition(t *Transition[T], earlier []int) []error {
+	var problems []error
+	if !d.states.Exists(t.From) {
+		problems = append(problems, &TransitionError{
+			Message: "source state not registered",
+			State:   t.From,
+			Event:   t.Event,
+			Err:     ErrStateNotRegistered,
+		})
+	}
+	if !d.states.Exists(t.To) {
+		problems = append(problems, &TransitionError{
+			Message: fmt.Sprintf("target state '%s' not registered", t.To),
+			State:   t.From,
+			Event:   t.Event,
+			Err:     ErrStateNotRegistered,
+		})
+	}
+	problems = append(problems, checkActions(t.Action, t.From, t.Event)...)
+
+	for _, i := range earlier {
+		prev := &d.transitions[i]
+		switch {
+		case prev.Guard.Fn == nil && t.Guard.Fn == nil,
+			prev.Guard.Fn != nil && t.Guard.Fn != nil && t.Guard.Name != "" && prev.Guard.Name == t.Guard.Name:
+			problems = append(problems, &TransitionError{
+				Message: fmt.Sprintf("duplicate transition to '%s'", t.To),
+				State:   t.From,
+				Event:   t.Event,
+				Err:     ErrTransitionAlreadyExists,
+			})
+		case prev.Guard.Fn == nil:
+			problems = append(problems, &TransitionError{
+				Message: fmt.Sprintf("transition to '%s' is shadowed by an unguarded transition", t.To),
+				State:   t.From,
+				Event:   t.Event,
+				Err:     ErrTransitionAlreadyExists,
+			})
+		default:
+			continue
+		}
+		break
+	}
+	return problems
+}
+
+// checkActions reports the actions without a function.
+func checkActions[T any](actions []Action[T], state State, event Event) []error {
+	var problems []error
+	for _, a := range actions {
+		if a.Fn == nil {
+			problems = append(problems, &ActionError{
+				ActionName: a.Name,
+				State:      string(state),
+				Event:      string(event),
+				Err:        ErrActionNil,
+			})
+		}
+	}
+	return problems
+}
+
+// reachable returns the states that can become active starting from the initial state, or
+// through a failure into the error state.
+// NOTE: Should be called with the lock
+func (d *Definition[T]) reachable() map[State]struct{} {
+	reached := make(map[State]struct{})
+	enter := func(queue []State, target State) []State {
+		if d.states.IsHistory(target) {
+			reached[target] = struct{}{}
+			target = d.states.Parent(target)
+		}
+		for _, st := range d.states.entrySet("", []State{target}) {
+			if _, ok := reached[st]; !ok {
+				reached[st] = struct{}{}
+				queue = append(queue, st)
+			}
+		}
+		return queue
+	}
+
+	queue := enter(nil, d.initial)
+	if d.errorState != "" && d.states.Exists(d.errorState) {
+		queue = enter(queue, d.errorState)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, positions := range d.byEvent[state] {
+			for _, i := range positions {
+				if to := d.transitions[i].To; d.states.Exists(to) {
+					queue = enter(queue, to)
+				}
+			}
+		}
+	}
+	return reached
+}
+
+// isDeadEnd reports whether the FSM could never leave state once in it.
+// NOTE: Should be called with the lock
+func (d *Definition[T]) isDeadEnd(state State) bool {
+	if len(d.states.Children(state)) > 0 {
+		return false
+	}
+	for _, st := range d.states.path(state) {
+		if d.states.IsFinal(st) || st == d.errorState || len(d.byEvent[st]) > 0 {
+			return false
+		}
+	}
+	return true
+}
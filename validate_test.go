@@ -0,0 +1,127 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSM_Validate(t *testing.T) {
+	noop := func(ctx context.Context, args *TestData) (*TestData, error) { return args, nil }
+
+	fsm := New[TestData](State("cart"))
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+	assert.NoError(t, fsm.RegisterState(State("shipped"), Final()))
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{Name: "charge", Fn: noop}})
+	fsm.AddTransition(State("paid"), State("shipped"), Event("ship"), nil)
+	assert.NoError(t, fsm.Validate())
+
+	assert.NoError(t, fsm.RegisterState(State("orphan")))
+	assert.NoError(t, fsm.RegisterState(State("stuck")))
+	assert.NoError(t, fsm.OnEnter(State("paid"), Action[TestData]{Name: "receipt"}))
+	fsm.AddTransition(State("paid"), State("stuck"), Event("hold"), nil)
+	fsm.AddTransition(State("cart"), State("gone"), Event("abandon"), nil)
+	fsm.AddTransition(State("cart"), State("shipped"), Event("pay"), nil)
+	fsm.AddTransition(State("orphan"), State("cart"), Event("retry"), []Action[TestData]{{Name: "notify"}})
+
+	err := fsm.Validate()
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+	assert.ErrorIs(t, err, ErrActionNil)
+	assert.ErrorIs(t, err, ErrTransitionAlreadyExists)
+	assert.ErrorIs(t, err, ErrUnreachableState)
+	assert.ErrorIs(t, err, ErrDeadEndState)
+
+	var problems []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var stateErr *StateError
+		var transitionErr *TransitionError
+		var actionErr *ActionError
+		switch {
+		case errors.As(e, &stateErr):
+			problems = append(problems, string(stateErr.State)+": "+stateErr.Err.Error())
+		case errors.As(e, &transitionErr):
+			problems = append(problems, string(transitionErr.State)+"/"+string(transitionErr.Event)+": "+transitionErr.Message)
+		case errors.As(e, &actionErr):
+			problems = append(problems, actionErr.ActionName+": "+actionErr.Err.Error())
+		}
+	}
+	assert.Equal(t, []string{
+		"cart/abandon: target state 'gone' not registered",
+		"cart/pay: duplicate transition to 'shipped'",
+		"notify: " + ErrActionNil.Error(),
+		"receipt: " + ErrActionNil.Error(),
+		"orphan: " + ErrUnreachableState.Error(),
+		"stuck: " + ErrDeadEndState.Error(),
+	}, problems)
+}
+
+func TestFSM_Validate_Statechart(t *testing.T) {
+	fsm := New[TestData](State("idle"))
+	assert.NoError(t, fsm.RegisterState(State("running"), Parallel()))
+	assert.NoError(t, fsm.RegisterState(State("motor"), WithParent(State("running"))))
+	assert.NoError(t, fsm.RegisterState(State("spinning"), WithParent(State("motor"))))
+	assert.NoError(t, fsm.RegisterState(State("lights"), WithParent(State("running"))))
+	assert.NoError(t, fsm.RegisterState(State("off"), WithParent(State("lights"))))
+	assert.NoError(t, fsm.RegisterState(State("on"), WithParent(State("lights"))))
+	assert.NoError(t, fsm.RegisterState(State("resume"), WithParent(State("lights")), WithHistory(HistoryShallow)))
+	assert.NoError(t, fsm.RegisterState(State("failed")))
+	fsm.SetErrorHandler(State("failed"), nil)
+
+	always := func(ctx context.Context, args *TestData) bool { return true }
+	fsm.AddTransition(State("idle"), State("running"), Event("start"), nil)
+	fsm.AddTransition(State("off"), State("on"), Event("toggle"), nil, WithGuard("daylight", always))
+	fsm.AddTransition(State("off"), State("on"), Event("toggle"), nil)
+	fsm.AddTransition(State("running"), State("idle"), Event("stop"), nil)
+
+	assert.NoError(t, fsm.Validate())
+
+	fsm.AddTransition(State("off"), State("idle"), Event("toggle"), nil, WithGuard("night", always))
+	err := fsm.Validate()
+	assert.ErrorIs(t, err, ErrTransitionAlreadyExists)
+	assert.Contains(t, err.Error(), "shadowed")
+}
+
+func TestFSM_Strict(t *testing.T) {
+	fsm := New[TestData](State("cart"), WithStrict())
+	assert.NoError(t, fsm.RegisterState(State("paid")))
+
+	fsm.AddTransition(State("cart"), State("gone"), Event("pay"), nil)
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), []Action[TestData]{{Name: "charge"}})
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), nil)
+	fsm.AddTransition(State("cart"), State("paid"), Event("pay"), nil)
+	assert.Len(t, fsm.transitions, 1)
+
+	err := fsm.Validate()
+	assert.ErrorIs(t, err, ErrStateNotRegistered)
+	assert.ErrorIs(t, err, ErrActionNil)
+	assert.ErrorIs(t, err, ErrTransitionAlreadyExists)
+
+	assert.ErrorIs(t, fsm.OnEnter(State("paid"), Action[TestData]{Name: "receipt"}), ErrActionNil)
+	assert.Empty(t, fsm.entryActions[State("paid")])
+}
+
+func TestFSM_Validate_UnnamedGuards(t *testing.T) {
+	def := NewDefinition[TestData](State("cart"))
+	assert.NoError(t, def.RegisterState(State("paid"), Final()))
+	assert.NoError(t, def.RegisterState(State("review"), Final()))
+	isBig := func(ctx context.Context, args *TestData) bool { return args.Counter > 10 }
+
+	def.AddTransition(State("cart"), State("review"), Event("pay"), nil, WithGuard("", isBig))
+	def.AddTransition(State("cart"), State("paid"), Event("pay"), nil)
+	assert.NoError(t, def.Validate())
+
+	fsm, err := def.NewInstance("order-1")
+	assert.NoError(t, err)
+	_, err = fsm.Trigger(context.Background(), Event("pay"), &TestData{Counter: 11})
+	assert.NoError(t, err)
+	assert.Equal(t, State("review"), fsm.GetState())
+
+	// A named guard without a function passes every event, so it shadows what follows it.
+	def = NewDefinition[TestData](State("cart"))
+	assert.NoError(t, def.RegisterState(State("paid"), Final()))
+	def.AddTransition(State("cart"), State("paid"), Event("pay"), nil, WithGuard[TestData]("placeholder", nil))
+	def.AddTransition(State("cart"), State("paid"), Event("pay"), nil, WithGuard("in_stock", isBig))
+	assert.ErrorIs(t, def.Validate(), ErrTransitionAlreadyExists)
+}